@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiVersion is bumped whenever a field of the JSON API changes meaning or is
+// removed. Adding fields does not change the version.
+const apiVersion = 1
+
+// apiListing is the JSON form of a folder listing
+type apiListing struct {
+	Version     int             `json:"version"`
+	Bucket      string          `json:"bucket"`
+	Prefix      string          `json:"prefix"`
+	SortBy      string          `json:"sortby"`
+	Sort        string          `json:"sort"`
+	Items       []apiObject     `json:"items"`
+	Breadcrumbs []apiBreadcrumb `json:"breadcrumbs"`
+	Pagination  apiPagination   `json:"pagination"`
+}
+
+// apiObject is a file or folder in a JSON listing
+type apiObject struct {
+	Key          string `json:"key"`
+	Name         string `json:"name"`
+	IsDirectory  bool   `json:"is_directory"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"last_modified,omitempty"` // RFC 3339, files only
+	Type         string `json:"type,omitempty"`          // file extension, files only
+	URL          string `json:"url,omitempty"`           // direct S3 URL, files only
+	Deleted      bool   `json:"deleted,omitempty"`       // latest version is a delete marker
+	Count        int    `json:"count,omitempty"`         // files below a summarized folder
+}
+
+// apiBreadcrumb is a folder on the path to the listed prefix
+type apiBreadcrumb struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+}
+
+// apiPagination describes where the listing page sits. Name-ascending
+// listings are paged with cursors and have no totals; other sort orders are
+// paged by number.
+type apiPagination struct {
+	Page       int    `json:"page"`
+	Limit      int    `json:"limit"`
+	MaxLimit   int    `json:"max_limit"`
+	TotalPages *int   `json:"total_pages,omitempty"`
+	Total      *int   `json:"total,omitempty"`
+	HasPrev    bool   `json:"has_prev"`
+	HasNext    bool   `json:"has_next"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Truncated  bool   `json:"truncated"`
+}
+
+// newAPIListing converts a listing to its JSON form
+func newAPIListing(b bucketView, prefix, sortBy, sortOrder string, l *listing) apiListing {
+	resp := apiListing{
+		Version:     apiVersion,
+		Bucket:      b.ID,
+		Prefix:      prefix,
+		SortBy:      sortBy,
+		Sort:        sortOrder,
+		Items:       make([]apiObject, 0, len(l.Items)),
+		Breadcrumbs: apiBreadcrumbs(b.Title, prefix),
+		Pagination: apiPagination{
+			Page:       l.Page,
+			Limit:      l.Limit,
+			MaxLimit:   min(maxPageLimit, b.maxListItems()),
+			HasPrev:    l.HasPrev,
+			HasNext:    l.HasNext,
+			PrevCursor: l.PrevCursor,
+			NextCursor: l.NextCursor,
+			Truncated:  l.Truncated,
+		},
+	}
+	if !l.Cursored {
+		totalPages, total := l.TotalPages, l.Total
+		resp.Pagination.TotalPages, resp.Pagination.Total = &totalPages, &total
+		resp.Pagination.HasPrev = l.Page > 1
+		resp.Pagination.HasNext = l.Page < l.TotalPages
+	}
+	for _, o := range l.Items {
+		item := apiObject{Key: o.Key, Name: o.Name, IsDirectory: o.IsDirectory, Size: o.Size}
+		if !o.IsDirectory {
+			item.LastModified = o.ModTime.UTC().Format(time.RFC3339)
+			item.Type = o.Type
+			item.URL = o.S3URL
+			item.Deleted = o.Deleted
+		} else if o.Summary != nil {
+			item.Count = o.Summary.Count
+			if !o.ModTime.IsZero() {
+				item.LastModified = o.ModTime.UTC().Format(time.RFC3339)
+			}
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	return resp
+}
+
+// apiBreadcrumbs lists the bucket root and each folder down to prefix
+func apiBreadcrumbs(bucketTitle, prefix string) []apiBreadcrumb {
+	crumbs := []apiBreadcrumb{{Name: bucketTitle, Prefix: ""}}
+	accum := ""
+	for _, part := range strings.Split(strings.TrimSuffix(prefix, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		accum += part + "/"
+		crumbs = append(crumbs, apiBreadcrumb{Name: part, Prefix: accum})
+	}
+	return crumbs
+}
+
+// handleAPIList serves /_/api/list, the JSON form of the browser listing. It
+// takes the same prefix, cursor, page, limit, sortby, sort and filter
+// parameters. limit is capped at maxPageLimit and the bucket's MaxListItems;
+// the response reports the page size actually used.
+func handleAPIList(ctx context.Context, w http.ResponseWriter, b bucketView, prefix string, page int, sortBy, sortOrder string, limit int, cursor string, filter listFilter, filterErrs []string) error {
+	ctx, cacheStatus := withCacheStatus(ctx)
+
+	if len(filterErrs) > 0 {
+		err := errors.New(strings.Join(filterErrs, " "))
+		writeJSONError(w, http.StatusBadRequest, err)
+		return err
+	}
+
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return err
+	}
+	l, err := fetchListing(ctx, b, prefix, page, sortBy, sortOrder, limit, c, filter)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("listing objects: %w", err))
+		return err
+	}
+
+	cacheStatus.SetHeader(w.Header())
+	return writeJSON(w, newAPIListing(b, prefix, sortBy, sortOrder, l))
+}
+
+// apiKey is one line of the recursive NDJSON listing
+type apiKey struct {
+	Key          string `json:"key"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"last_modified"` // RFC 3339
+	URL          string `json:"url"`
+}
+
+// apiKeysTruncated is the last line of a recursive listing that stopped at
+// its max; listing again with start_after resumes it
+type apiKeysTruncated struct {
+	Truncated  bool   `json:"truncated"`
+	StartAfter string `json:"start_after"`
+}
+
+// handleAPIKeys serves /_/api/keys, every key under prefix as
+// newline-delimited JSON. Lines are written as the S3 pages arrive. At most
+// maxItems keys are listed when it is positive, and the listing starts after
+// startAfter.
+func handleAPIKeys(ctx context.Context, w http.ResponseWriter, b bucketView, prefix, startAfter string, maxItems int) error {
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	count, last, started := 0, "", false
+
+	err := walkObjects(ctx, b.Store, prefix, startAfter, func(objects []ObjectInfo) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			started = true
+		}
+		for _, o := range objects {
+			if maxItems > 0 && count == maxItems {
+				if err := enc.Encode(apiKeysTruncated{Truncated: true, StartAfter: last}); err != nil {
+					return err
+				}
+				return errStopWalk
+			}
+			if err := enc.Encode(apiKey{
+				Key:          o.Key,
+				Size:         o.Size,
+				LastModified: o.LastModified.UTC().Format(time.RFC3339),
+				URL:          b.Store.URL(o.Key),
+			}); err != nil {
+				return err
+			}
+			count++
+			last = o.Key
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if !started {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("listing objects: %w", err))
+			return err
+		}
+		// The status has been sent; report the failure as the last line
+		if encErr := enc.Encode(map[string]string{"error": err.Error()}); encErr != nil {
+			fmt.Printf("Error writing response: %v\n", encErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeJSON writes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// writeJSONError writes a JSON error response
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if encErr := json.NewEncoder(w).Encode(map[string]any{"version": apiVersion, "error": err.Error()}); encErr != nil {
+		fmt.Printf("Error writing response: %v\n", encErr)
+	}
+}
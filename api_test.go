@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func getAPIListing(t *testing.T, url string) apiListing {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s status = %d", url, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var l apiListing
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		t.Fatalf("decoding %s: %v", url, err)
+	}
+	return l
+}
+
+func TestAPIList(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/a.csv":     "a",
+		"data/b.csv":     "bbbb",
+		"data/sub/c.csv": "c",
+	})
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	l := getAPIListing(t, srv.URL+"/_/api/list?prefix=data/&limit=2")
+	if l.Version != apiVersion || l.Bucket != "test" || l.Prefix != "data/" {
+		t.Errorf("listing header = %+v", l)
+	}
+	if len(l.Items) != 2 || l.Items[0].Key != "data/a.csv" || l.Items[0].LastModified != "2024-01-02T03:04:05Z" ||
+		l.Items[0].URL != "https://fake.example/data/a.csv" || l.Items[0].Type != "csv" {
+		t.Errorf("items = %+v", l.Items)
+	}
+	if !l.Pagination.HasNext || l.Pagination.NextCursor == "" || l.Pagination.Total != nil {
+		t.Errorf("cursor pagination = %+v", l.Pagination)
+	}
+	if len(l.Breadcrumbs) != 2 || l.Breadcrumbs[1] != (apiBreadcrumb{Name: "data", Prefix: "data/"}) {
+		t.Errorf("breadcrumbs = %+v", l.Breadcrumbs)
+	}
+
+	next := getAPIListing(t, srv.URL+"/_/api/v1/list?prefix=data/&limit=2&cursor="+l.Pagination.NextCursor)
+	if len(next.Items) != 1 || next.Items[0].Key != "data/sub/" || !next.Items[0].IsDirectory || next.Items[0].URL != "" {
+		t.Errorf("second page items = %+v", next.Items)
+	}
+
+	bySize := getAPIListing(t, srv.URL+"/_/api/list?prefix=data/&sortby=size&sort=desc&limit=2&page=2")
+	if bySize.Pagination.Total == nil || *bySize.Pagination.Total != 3 || *bySize.Pagination.TotalPages != 2 || bySize.Pagination.HasNext || !bySize.Pagination.HasPrev {
+		t.Errorf("numbered pagination = %+v", bySize.Pagination)
+	}
+	if len(bySize.Items) != 1 || bySize.Items[0].Key != "data/a.csv" {
+		t.Errorf("size-sorted second page = %+v", bySize.Items)
+	}
+
+	resp, err := http.Get(srv.URL + "/_/api/list?cursor=%21")
+	if err != nil {
+		t.Fatalf("GET bad cursor: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad cursor status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestAPIListReportsEffectiveLimit(t *testing.T) {
+	store := newFakeStore(map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"})
+	reg := newBucketRegistry("Test", []*Bucket{{ID: "test", Title: "Test Bucket", Store: store, MaxListItems: 3}})
+	srv := httptest.NewServer(newHandler(reg, newTemplate()))
+	defer srv.Close()
+
+	l := getAPIListing(t, srv.URL+"/_/api/list?limit=100000")
+	if l.Pagination.Limit != 3 || l.Pagination.MaxLimit != 3 || len(l.Items) != 3 {
+		t.Errorf("pagination = %+v with %d items, want limit and max_limit 3", l.Pagination, len(l.Items))
+	}
+
+	l = getAPIListing(t, srv.URL+"/_/api/list?limit=2")
+	if l.Pagination.Limit != 2 || l.Pagination.MaxLimit != 3 {
+		t.Errorf("pagination = %+v, want limit 2 and max_limit 3", l.Pagination)
+	}
+}
+
+func TestAPIKeysStreamsRecursively(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/2024/a.mseed":      "a",
+		"data/2024/b.mseed":      "bb",
+		"data/2024/deep/c.mseed": "ccc",
+		"data/2025/d.mseed":      "dddd",
+		"other/e.mseed":          "e",
+	})
+	store.pageSize = 2
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	lines := func(query string) []string {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/_/api/keys?" + query)
+		if err != nil {
+			t.Fatalf("GET %s: %v", query, err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "application/x-ndjson" {
+			t.Fatalf("GET %s = %d %q", query, resp.StatusCode, ct)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	}
+
+	got := lines("prefix=data/&max=3")
+	want := []string{
+		`{"key":"data/2024/a.mseed","size":1,"last_modified":"2024-01-02T03:04:05Z","url":"https://fake.example/data/2024/a.mseed"}`,
+		`{"key":"data/2024/b.mseed","size":2,"last_modified":"2024-01-02T03:04:05Z","url":"https://fake.example/data/2024/b.mseed"}`,
+		`{"key":"data/2024/deep/c.mseed","size":3,"last_modified":"2024-01-02T03:04:05Z","url":"https://fake.example/data/2024/deep/c.mseed"}`,
+		`{"truncated":true,"start_after":"data/2024/deep/c.mseed"}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("first batch =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	got = lines("prefix=data/&max=3&start_after=data/2024/deep/c.mseed")
+	if len(got) != 1 || !strings.Contains(got[0], `"key":"data/2025/d.mseed"`) {
+		t.Errorf("resumed batch = %q", got)
+	}
+
+	resp, err := http.Get(srv.URL + "/_/api/keys?max=-1")
+	if err != nil {
+		t.Fatalf("GET invalid max: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid max status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
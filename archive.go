@@ -0,0 +1,377 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const archiveErrorTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{.Heading}} - {{.Title}}</title>
+    {{template "style"}}
+    {{template "theme"}}
+</head>
+<body>
+    <div class="container">
+        <h1>{{.Heading}}</h1>
+        <p class="notice error" role="alert">{{.Message}}</p>
+        <p>{{.Action}} a smaller folder, or fetch the files one by one from the <a href="{{.BasePath}}?prefix={{.Prefix}}">folder listing</a>.</p>
+    </div>
+</body>
+</html>`
+
+// archivePage is the data of the archive error page
+type archivePage struct {
+	Title, BasePath, Prefix, Message string
+	archiveAction
+}
+
+// archiveAction words the errors of a folder download or export
+type archiveAction struct {
+	Heading string // the title of the error page, e.g. "Download too large"
+	Action  string // the verb, e.g. "Download"
+	Done    string // its past participle, e.g. "downloaded"
+}
+
+var (
+	archiveDownload = archiveAction{Heading: "Download too large", Action: "Download", Done: "downloaded"}
+	archiveExport   = archiveAction{Heading: "Export too large", Action: "Export", Done: "exported"}
+)
+
+// archiveLimitError reports a folder too large to download as one archive
+type archiveLimitError struct {
+	Prefix     string
+	MaxBytes   int64
+	MaxObjects int
+	Objects    bool   // the object limit was hit, rather than the size limit
+	Done       string // what was refused, "downloaded" when empty
+}
+
+func (e *archiveLimitError) Error() string {
+	folder, done := "/"+e.Prefix, e.Done
+	if done == "" {
+		done = archiveDownload.Done
+	}
+	if e.Objects {
+		return fmt.Sprintf("%s holds more than %d files, the most that can be %s at once.", folder, e.MaxObjects, done)
+	}
+	return fmt.Sprintf("%s holds more than %s, the most that can be %s at once.", folder, formatSize(e.MaxBytes), done)
+}
+
+// archiveObjects lists every file under prefix for an archive, failing with
+// an *archiveLimitError as soon as the limits are exceeded
+func archiveObjects(ctx context.Context, store ObjectStore, prefix string, maxBytes int64, maxObjects int) ([]ObjectInfo, error) {
+	limitErr := &archiveLimitError{Prefix: prefix, MaxBytes: maxBytes, MaxObjects: maxObjects}
+	var objects []ObjectInfo
+	var total int64
+	err := walkObjects(ctx, store, prefix, "", func(page []ObjectInfo) error {
+		for _, o := range page {
+			// Zero-byte folder markers
+			if strings.HasSuffix(o.Key, "/") {
+				continue
+			}
+			if len(objects) == maxObjects {
+				limitErr.Objects = true
+				return limitErr
+			}
+			if total += o.Size; total > maxBytes {
+				return limitErr
+			}
+			objects = append(objects, o)
+		}
+		return nil
+	})
+	return objects, err
+}
+
+// archivePrefix is the folder prefix an archive request names
+func archivePrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// archiveRoot is the top-level folder name inside an archive of prefix
+func archiveRoot(b bucketView, prefix string) string {
+	root := path.Base(prefix)
+	if prefix == "" || root == "." || root == ".." || strings.Contains(root, `\`) {
+		return b.ID
+	}
+	return root
+}
+
+// errUnsafeEntryName marks a file left out of an archive because its name
+// would be extracted outside the archive's folder
+var errUnsafeEntryName = errors.New("left out: its name leads outside the folder")
+
+// archiveEntryName is the name of key inside an archive of prefix rooted at
+// root. S3 keys may hold ".." segments and backslashes, which would let a
+// file escape the folder it is extracted to; such keys are rejected with
+// errUnsafeEntryName.
+func archiveEntryName(root, prefix, key string) (string, error) {
+	rel := strings.TrimPrefix(key, prefix)
+	name := path.Clean(root + "/" + rel)
+	if strings.Contains(rel, `\`) || !strings.HasPrefix(name, root+"/") {
+		return "", errUnsafeEntryName
+	}
+	return name, nil
+}
+
+// startArchive lists the files of an archive or export of prefix within the
+// given limits, worded by action. It writes the error response itself and
+// returns a nil slice when the archive cannot be made.
+func startArchive(ctx context.Context, w http.ResponseWriter, b bucketView, prefix string, maxBytes int64, maxObjects int, action archiveAction, tmpl *template.Template) ([]ObjectInfo, error) {
+	objects, err := archiveObjects(ctx, b.Store, prefix, maxBytes, maxObjects)
+	var limitErr *archiveLimitError
+	switch {
+	case errors.As(err, &limitErr):
+		limitErr.Done = action.Done
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		if err := tmpl.ExecuteTemplate(w, "archive_error", archivePage{Title: b.Title, BasePath: b.BasePath, Prefix: prefix, Message: limitErr.Error(), archiveAction: action}); err != nil {
+			fmt.Printf("Error rendering template: %v\n", err)
+		}
+		return nil, err
+	case err != nil:
+		writeErrorf(w, http.StatusInternalServerError, "Error listing objects: %v\n", err)
+		return nil, err
+	case len(objects) == 0:
+		handleNotFound(w, fmt.Sprintf("There are no files in /%s to %s.", prefix, strings.ToLower(action.Action)), tmpl)
+		return nil, fmt.Errorf("no files under %q", prefix)
+	}
+	return objects, nil
+}
+
+// setAttachment names the download of an archive
+func setAttachment(w http.ResponseWriter, contentType, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
+
+// openObject starts fetching one object of an archive from the origin
+func openObject(ctx context.Context, store ObjectStore, key string) (io.ReadCloser, error) {
+	resp, err := store.Get(ctx, key, GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		closeBody(resp.Body)
+		return nil, &originStatusError{resp.StatusCode}
+	}
+	return resp.Body, nil
+}
+
+func closeBody(body io.Closer) {
+	if err := body.Close(); err != nil {
+		fmt.Printf("Error closing response body: %v\n", err)
+	}
+}
+
+// copyObject streams one object from the origin into dst
+func copyObject(ctx context.Context, store ObjectStore, key string, dst io.Writer) error {
+	body, err := openObject(ctx, store, key)
+	if err != nil {
+		return err
+	}
+	defer closeBody(body)
+	_, err = io.Copy(dst, body)
+	return err
+}
+
+// archiveFailures is the text of the ERRORS.txt entry that ends an archive
+// when some files could not be fetched
+func archiveFailures(failures []string) string {
+	return fmt.Sprintf("These files could not be downloaded:\n%s\n", strings.Join(failures, "\n"))
+}
+
+// handleZip serves /_/zip, every file under prefix as a store-only ZIP
+// streamed while the files are fetched. Files that cannot be fetched once
+// the response has started are listed in an ERRORS.txt entry at the end.
+func handleZip(ctx context.Context, w http.ResponseWriter, b bucketView, prefix string, tmpl *template.Template) error {
+	prefix = archivePrefix(prefix)
+	maxBytes, maxObjects := b.archiveLimits()
+	objects, err := startArchive(ctx, w, b, prefix, maxBytes, maxObjects, archiveDownload, tmpl)
+	if objects == nil {
+		return err
+	}
+
+	root := archiveRoot(b, prefix)
+	setAttachment(w, "application/zip", root+".zip")
+	flusher, _ := w.(http.Flusher)
+	zw := zip.NewWriter(w)
+	var failures []string
+	for _, o := range objects {
+		name, err := archiveEntryName(root, prefix, o.Key)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", o.Key, err))
+			continue
+		}
+		// archive/zip adds ZIP64 records by itself once sizes or offsets
+		// outgrow 32 bits
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Store,
+			Modified: o.LastModified,
+		})
+		if err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+			return err
+		}
+		if err := copyObject(ctx, b.Store, o.Key, fw); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", o.Key, err))
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if len(failures) > 0 {
+		fw, err := zw.Create(root + "/ERRORS.txt")
+		if err == nil {
+			_, err = io.WriteString(fw, archiveFailures(failures))
+		}
+		if err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// handleTar serves /_/tar and /_/tar.gz, every file under prefix as a tar
+// archive, gzip-compressed when compress is set. Files are streamed one at a
+// time with their listed size and LastModified as mtime; a file that cannot
+// be fetched, or whose size changed since the listing, is reported in an
+// ERRORS.txt entry at the end, zero-padded if its header was already sent.
+func handleTar(ctx context.Context, w http.ResponseWriter, b bucketView, prefix string, compress bool, tmpl *template.Template) error {
+	prefix = archivePrefix(prefix)
+	maxBytes, maxObjects := b.archiveLimits()
+	objects, err := startArchive(ctx, w, b, prefix, maxBytes, maxObjects, archiveDownload, tmpl)
+	if objects == nil {
+		return err
+	}
+
+	root := archiveRoot(b, prefix)
+	var out io.Writer = w
+	flush := func() error { return nil }
+	if compress {
+		setAttachment(w, "application/gzip", root+".tar.gz")
+		gw := gzip.NewWriter(w)
+		defer func() {
+			if err := gw.Close(); err != nil {
+				fmt.Printf("Error writing response: %v\n", err)
+			}
+		}()
+		out, flush = gw, gw.Flush
+	} else {
+		setAttachment(w, "application/x-tar", root+".tar")
+	}
+	flusher, _ := w.(http.Flusher)
+	tw := tar.NewWriter(out)
+	var failures []string
+	for _, o := range objects {
+		name, err := archiveEntryName(root, prefix, o.Key)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", o.Key, err))
+			continue
+		}
+		if err := writeTarEntry(ctx, tw, b.Store, o, name); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var werr *tarWriteError
+			if errors.As(err, &werr) {
+				fmt.Printf("Error writing response: %v\n", err)
+				return err
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", o.Key, err))
+		}
+		if err := flush(); err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if len(failures) > 0 {
+		text := archiveFailures(failures)
+		err := tw.WriteHeader(&tar.Header{Name: root + "/ERRORS.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(text)), ModTime: time.Now()})
+		if err == nil {
+			_, err = io.WriteString(tw, text)
+		}
+		if err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// tarWriteError is a failure to write the archive itself, after which the
+// response cannot continue
+type tarWriteError struct{ err error }
+
+func (e *tarWriteError) Error() string { return e.err.Error() }
+func (e *tarWriteError) Unwrap() error { return e.err }
+
+// writeTarEntry adds o to tw under name. A tar header carries the size up
+// front, so a body shorter than listed is zero-padded and reported.
+func writeTarEntry(ctx context.Context, tw *tar.Writer, store ObjectStore, o ObjectInfo, name string) error {
+	body, err := openObject(ctx, store, o.Key)
+	if err != nil {
+		// Nothing written yet: the entry is left out
+		return err
+	}
+	defer closeBody(body)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: o.Size, ModTime: o.LastModified}); err != nil {
+		return &tarWriteError{err}
+	}
+	n, copyErr := io.Copy(tw, io.LimitReader(body, o.Size))
+	if copyErr == nil && n < o.Size {
+		copyErr = fmt.Errorf("got %d of %d bytes", n, o.Size)
+	}
+	if copyErr == nil {
+		if m, _ := body.Read(make([]byte, 1)); m > 0 {
+			return fmt.Errorf("grew since it was listed, truncated to %d bytes", o.Size)
+		}
+		return nil
+	}
+	if _, err := io.CopyN(tw, zeroReader{}, o.Size-n); err != nil {
+		return &tarWriteError{err}
+	}
+	return copyErr
+}
+
+// zeroReader is an endless stream of zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestZipDownload(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/":          "",
+		"data/a b.csv":   "abc",
+		"data/sub/c.csv": "c",
+		"other.txt":      "other",
+	})
+	store.pageSize = 1
+	handler := newHandler(newTestRegistry(store), newTemplate())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/_/zip?prefix=data", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("GET /zip = %d %v", rec.Code, rec.Header())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename=data.zip` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	want := map[string]string{"data/a b.csv": "abc", "data/sub/c.csv": "c"}
+	if len(zr.File) != len(want) {
+		t.Errorf("archive holds %d files, want %d", len(zr.File), len(want))
+	}
+	for _, f := range zr.File {
+		if f.Method != zip.Store || !f.Modified.Equal(store.modified) {
+			t.Errorf("%s: method %d, modified %v", f.Name, f.Method, f.Modified)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(body) != want[f.Name] {
+			t.Errorf("%s = %q, want %q", f.Name, body, want[f.Name])
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/_/zip?prefix=missing/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing folder status = %d, want 404", rec.Code)
+	}
+}
+
+func TestZipLeavesOutEscapingKeys(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/ok.csv":       "ok",
+		"data/a/../../evil": "evil",
+		"data/a/../b.csv":   "b",
+		`data/..\evil.txt`:  "evil",
+	})
+	handler := newHandler(newTestRegistry(store), newTemplate())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/_/zip?prefix=data/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /_/zip = %d", rec.Code)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	got := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(body)
+	}
+	if len(got) != 3 || got["data/ok.csv"] != "ok" || got["data/b.csv"] != "b" {
+		t.Errorf("archive = %v", got)
+	}
+	for _, key := range []string{"data/a/../../evil", `data/..\evil.txt`} {
+		if !strings.Contains(got["data/ERRORS.txt"], key+": "+errUnsafeEntryName.Error()) {
+			t.Errorf("ERRORS.txt does not list %s: %q", key, got["data/ERRORS.txt"])
+		}
+	}
+}
+
+func TestZipLimits(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/a.csv": "aaaa",
+		"data/b.csv": "bbbb",
+	})
+	for _, c := range []struct {
+		maxBytes   int64
+		maxObjects int
+		want       string
+	}{
+		{maxBytes: 7, want: "more than 7 B"},
+		{maxObjects: 1, want: "more than 1 files"},
+	} {
+		reg := newBucketRegistry("Test", []*Bucket{{ID: "test", Title: "Test Bucket", Store: store, ArchiveMaxBytes: c.maxBytes, ArchiveMaxObjects: c.maxObjects}})
+		rec := httptest.NewRecorder()
+		newHandler(reg, newTemplate()).ServeHTTP(rec, httptest.NewRequest("GET", "/_/zip?prefix=data/", nil))
+		body := rec.Body.String()
+		if rec.Code != http.StatusForbidden || !strings.Contains(body, "/data/ holds "+c.want) || !strings.Contains(body, `href="/?prefix=data%2f"`) {
+			t.Errorf("limits %d/%d: %d\n%s", c.maxBytes, c.maxObjects, rec.Code, body)
+		}
+	}
+}
+
+// brokenGetStore is a store whose GETs of one key fail after it was listed
+type brokenGetStore struct {
+	ObjectStore
+	fail string
+}
+
+func (f brokenGetStore) Get(ctx context.Context, key string, opts GetOptions) (*ObjectResponse, error) {
+	if key == f.fail {
+		return &ObjectResponse{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: http.NoBody}, nil
+	}
+	return f.ObjectStore.Get(ctx, key, opts)
+}
+
+func TestTarDownload(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/a b.csv":   "abc",
+		"data/bad.csv":   "bad",
+		"data/sub/c.csv": "c",
+	})
+	handler := newHandler(newTestRegistry(brokenGetStore{store, "data/bad.csv"}), newTemplate())
+
+	for _, route := range []string{"/_/tar", "/_/tar.gz"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", route+"?prefix=data/", nil))
+		if rec.Code != http.StatusOK || !strings.HasSuffix(rec.Header().Get("Content-Disposition"), "filename=data."+strings.TrimPrefix(route, "/_/")) {
+			t.Fatalf("GET %s = %d %v", route, rec.Code, rec.Header())
+		}
+		var r io.Reader = rec.Body
+		if route == "/_/tar.gz" {
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				t.Fatalf("%s: %v", route, err)
+			}
+			r = gr
+		}
+		tr := tar.NewReader(r)
+		got := map[string]string{}
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: reading archive: %v", route, err)
+			}
+			body, _ := io.ReadAll(tr)
+			got[h.Name] = string(body)
+			if h.Name != "data/ERRORS.txt" && !h.ModTime.Equal(store.modified) {
+				t.Errorf("%s: %s mtime = %v", route, h.Name, h.ModTime)
+			}
+		}
+		if got["data/a b.csv"] != "abc" || got["data/sub/c.csv"] != "c" || len(got) != 3 {
+			t.Errorf("%s: archive = %v", route, got)
+		}
+		if !strings.Contains(got["data/ERRORS.txt"], "data/bad.csv: origin returned status 503") {
+			t.Errorf("%s: ERRORS.txt = %q", route, got["data/ERRORS.txt"])
+		}
+	}
+}
+
+func TestTarLeavesOutEscapingKeys(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/ok.csv":       "ok",
+		"data/a/../../evil": "evil",
+	})
+	handler := newHandler(newTestRegistry(store), newTemplate())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/_/tar?prefix=data/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /_/tar = %d", rec.Code)
+	}
+	tr := tar.NewReader(rec.Body)
+	got := map[string]string{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading archive: %v", err)
+		}
+		body, _ := io.ReadAll(tr)
+		got[h.Name] = string(body)
+	}
+	if len(got) != 2 || got["data/ok.csv"] != "ok" {
+		t.Errorf("archive = %v", got)
+	}
+	if !strings.Contains(got["data/ERRORS.txt"], "data/a/../../evil: "+errUnsafeEntryName.Error()) {
+		t.Errorf("ERRORS.txt = %q", got["data/ERRORS.txt"])
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// autoindexNameWidth is the width of the name column, as in nginx
+const autoindexNameWidth = 50
+
+// handleAutoindex serves _/index/, a path-based listing in the plain HTML of
+// nginx's autoindex that wget -r, rclone and lftp can crawl. Folders are
+// listed in full under index/<prefix>/ with relative links, and
+// index/<key> proxies the file, so every link stays below the listed folder.
+func handleAutoindex(ctx context.Context, w http.ResponseWriter, r *http.Request, b bucketView, key string) error {
+	if key != "" && !strings.HasSuffix(key, "/") {
+		if r.Method == "HEAD" {
+			return handleFileHead(ctx, w, b.Store, key)
+		}
+		return handleFileRequest(ctx, w, b.Store, key, GetOptions{Range: r.Header.Get("Range")})
+	}
+
+	objects, truncated, err := listObjects(ctx, b.Store, key, b.maxListItems())
+	if err != nil {
+		writeErrorf(w, http.StatusInternalServerError, "Error listing objects: %v\n", err)
+		return err
+	}
+	if key != "" && len(objects) == 0 {
+		writeErrorf(w, http.StatusNotFound, "Not found: %s\n", key)
+		return fmt.Errorf("%s not found", key)
+	}
+	var folders, files []S3Object
+	for _, o := range objects {
+		if o.IsDirectory {
+			folders = append(folders, o)
+		} else {
+			files = append(files, o)
+		}
+	}
+	objects = sortObjects(folders, files, "name", sortOrderAsc)
+
+	title := html.EscapeString(b.BasePath + toolNamespace + "index/" + key)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<html>\n<head><title>Index of %s</title></head>\n<body>\n<h1>Index of %s</h1><hr><pre>", title, title)
+	if key != "" {
+		sb.WriteString(`<a href="../">../</a>` + "\n")
+	}
+	for _, o := range objects {
+		name, size, modified := o.Name, "-", ""
+		if o.IsDirectory {
+			name += "/"
+		} else {
+			size = fmt.Sprint(o.Size)
+			modified = o.ModTime.UTC().Format("02-Jan-2006 15:04")
+		}
+		// String rather than EscapedPath, so a name with a colon is not
+		// taken for a URL scheme
+		href := (&url.URL{Path: name}).String()
+		fmt.Fprintf(&sb, `<a href="%s">%s</a>`, html.EscapeString(href), html.EscapeString(name))
+		sb.WriteString(strings.Repeat(" ", max(autoindexNameWidth-len([]rune(name)), 0)+1))
+		fmt.Fprintf(&sb, "%-17s %19s\n", modified, size)
+	}
+	sb.WriteString("</pre><hr>")
+	if truncated {
+		fmt.Fprintf(&sb, "<p>Only the first %d entries are listed.</p>", b.maxListItems())
+	}
+	sb.WriteString("</body>\n</html>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := fmt.Fprint(w, sb.String()); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var hrefPattern = regexp.MustCompile(`<a href="([^"]*)"`)
+
+// parseIndex extracts the entries of a directory listing the way rclone's
+// http backend does: links must stay on the same host, lie directly below
+// the listed directory, and carry no query string. Other links are skipped.
+func parseIndex(base *url.URL, body string) ([]string, error) {
+	var names []string
+	for _, m := range hrefPattern.FindAllStringSubmatch(body, -1) {
+		u, err := url.Parse(strings.ReplaceAll(m[1], "&amp;", "&"))
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(u.String(), "?") {
+			continue
+		}
+		u = base.ResolveReference(u)
+		if u.Scheme != base.Scheme || u.Host != base.Host || !strings.HasPrefix(u.Path, base.Path) {
+			continue
+		}
+		name := u.Path[len(base.Path):]
+		if name == "" {
+			continue
+		}
+		if i := strings.Index(name, "/"); i >= 0 && i != len(name)-1 {
+			return nil, errors.New("link below a sub-directory: " + m[1])
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func TestAutoindexCrawl(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/a b.csv":       "abc",
+		"data/x:y.txt":       "colon",
+		"data/sub/c.csv":     "c",
+		"data/sub/deep/d.gz": "dd",
+		"top.txt":            "top",
+	})
+	store.pageSize = 2
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	get := func(u string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(u)
+		if err != nil {
+			t.Fatalf("GET %s: %v", u, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// Crawl the tree from the root as rclone would, reading every file
+	files := map[string]string{}
+	queue := []string{srv.URL + "/_/index/"}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		status, body := get(dir)
+		if status != http.StatusOK {
+			t.Fatalf("GET %s = %d", dir, status)
+		}
+		base, _ := url.Parse(dir)
+		names, err := parseIndex(base, body)
+		if err != nil {
+			t.Fatalf("parsing %s: %v\n%s", dir, err, body)
+		}
+		for _, name := range names {
+			u := base.ResolveReference(&url.URL{Path: name})
+			if strings.HasSuffix(name, "/") {
+				queue = append(queue, u.String())
+				continue
+			}
+			_, content := get(u.String())
+			files[strings.TrimPrefix(u.Path, "/_/index/")] = content
+		}
+	}
+	for key, want := range store.objects {
+		if files[key] != want {
+			t.Errorf("crawled %s = %q, want %q", key, files[key], want)
+		}
+	}
+	if len(files) != len(store.objects) {
+		t.Errorf("crawled %d files, want %d: %v", len(files), len(store.objects), files)
+	}
+
+	_, body := get(srv.URL + "/_/index/data/")
+	if !strings.Contains(body, "<title>Index of /_/index/data/</title>") || !strings.Contains(body, `<a href="../">../</a>`) ||
+		!regexp.MustCompile(`<a href="a%20b.csv">a b.csv</a> +02-Jan-2024 03:04 +3\n`).MatchString(body) {
+		t.Errorf("listing is not in autoindex form:\n%s", body)
+	}
+	if status, _ := get(srv.URL + "/_/index/missing/"); status != http.StatusNotFound {
+		t.Errorf("missing folder status = %d, want 404", status)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const landingTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{.Title}}</title>
+    {{template "style"}}
+    {{template "theme"}}
+</head>
+<body>
+    <div class="container">
+        <div class="theme-toggle">
+            <button onclick="toggleTheme()" aria-label="Toggle dark mode">🌓 Theme</button>
+        </div>
+        <h1>{{.Title}}</h1>
+        <table aria-label="Bucket list">
+            <thead>
+                <tr>
+                    <th>Name</th>
+                    <th>Bucket</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{range .Buckets}}
+                <tr>
+                    <td><span class="icon" aria-label="Bucket">🪣</span> <a href="/b/{{.ID}}/" class="folder">{{.Title}}</a></td>
+                    <td>{{.Name}}</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+    </div>
+</body>
+</html>`
+
+const notFoundTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Not Found</title>
+    {{template "style"}}
+    {{template "theme"}}
+</head>
+<body>
+    <div class="container">
+        <h1>Not Found</h1>
+        <p>{{.}}</p>
+    </div>
+</body>
+</html>`
+
+// Bucket is a browsable bucket registered with the router
+type Bucket struct {
+	ID    string // route name, the bucket is served under /b/<ID>/
+	Name  string // S3 bucket name
+	Title string
+	Store ObjectStore
+
+	// MaxListItems caps listings that must be fetched in full to be sorted;
+	// 0 means defaultMaxListItems
+	MaxListItems int
+
+	// SummaryCache keeps folder summaries for SummaryTTL; nil to compute
+	// them on every request
+	SummaryCache listingCache
+	SummaryTTL   time.Duration
+
+	// ArchiveMaxBytes and ArchiveMaxObjects limit folder downloads; 0 means
+	// the defaults
+	ArchiveMaxBytes   int64
+	ArchiveMaxObjects int
+}
+
+func (b *Bucket) maxListItems() int {
+	if b.MaxListItems > 0 {
+		return b.MaxListItems
+	}
+	return defaultMaxListItems
+}
+
+func (b *Bucket) archiveLimits() (maxBytes int64, maxObjects int) {
+	maxBytes, maxObjects = b.ArchiveMaxBytes, b.ArchiveMaxObjects
+	if maxBytes <= 0 {
+		maxBytes = defaultArchiveMaxBytes
+	}
+	if maxObjects <= 0 {
+		maxObjects = defaultArchiveMaxObjects
+	}
+	return maxBytes, maxObjects
+}
+
+// bucketView is a bucket as mounted for a particular request
+type bucketView struct {
+	*Bucket
+	BasePath string // path the bucket is served under, always ending in /
+	HomeURL  string // landing page link, empty when the bucket is the only one
+}
+
+// bucketRegistry holds the buckets served by a deployment, in configured order
+type bucketRegistry struct {
+	Title   string
+	Buckets []*Bucket
+	byID    map[string]*Bucket
+	hosts   map[string]*Bucket // tenant hostnames, nil when host routing is off
+}
+
+func newBucketRegistry(title string, buckets []*Bucket) *bucketRegistry {
+	reg := &bucketRegistry{Title: title, Buckets: buckets, byID: make(map[string]*Bucket, len(buckets))}
+	for _, b := range buckets {
+		reg.byID[b.ID] = b
+	}
+	return reg
+}
+
+// newBucketRegistryFromConfig creates an S3 store for every configured bucket.
+// clientFor returns the HTTP client used to reach a bucket's origin. Listings
+// are kept in cache, when not nil, according to each bucket's cache policy.
+func newBucketRegistryFromConfig(cfg Config, clientFor func(BucketConfig) *http.Client, cache listingCache) *bucketRegistry {
+	buckets := make([]*Bucket, 0, len(cfg.Buckets))
+	for _, bc := range cfg.Buckets {
+		s3 := newS3Store(clientFor(bc), bc.BucketURL())
+		s3.listV1 = bc.ListAPI == "v1"
+		if bc.Credentials.AccessKeyID != "" {
+			s3.signer = newSigV4Signer(bc.Credentials, bc.SigningRegion())
+		}
+		var store ObjectStore = s3
+		if cache != nil && bc.Cache.TTL > 0 {
+			store = newCachedStore(store, cache, bc.Cache, bc.ID)
+		}
+		if bc.Prefix != "" {
+			store = &prefixedStore{ObjectStore: store, root: bc.Prefix}
+		}
+		b := &Bucket{
+			ID:           bc.ID,
+			Name:         bc.Bucket,
+			Title:        bc.Title,
+			Store:        store,
+			MaxListItems: bc.MaxListItems,
+
+			ArchiveMaxBytes:   bc.ArchiveMaxBytes,
+			ArchiveMaxObjects: bc.ArchiveMaxObjects,
+		}
+		if cache != nil && bc.SummaryTTL > 0 {
+			b.SummaryCache, b.SummaryTTL = cache, bc.SummaryTTL
+		}
+		buckets = append(buckets, b)
+	}
+	reg := newBucketRegistry(cfg.Title, buckets)
+	for host, id := range cfg.Hosts {
+		// IDs were validated by loadConfig
+		_ = reg.AddHost(host, id)
+	}
+	return reg
+}
+
+// AddHost maps requests for host to the bucket with the given route ID.
+// Once any host is mapped, requests for unmapped hosts are rejected.
+func (reg *bucketRegistry) AddHost(host, id string) error {
+	b := reg.byID[id]
+	if b == nil {
+		return fmt.Errorf("unknown bucket ID %q", id)
+	}
+	if reg.hosts == nil {
+		reg.hosts = map[string]*Bucket{}
+	}
+	reg.hosts[strings.ToLower(host)] = b
+	return nil
+}
+
+// ForHost resolves the tenant bucket for a request Host header. ok is false
+// when host routing is not configured; b is nil for unknown hosts.
+func (reg *bucketRegistry) ForHost(host string) (b *Bucket, ok bool) {
+	if reg.hosts == nil {
+		return nil, false
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return reg.hosts[strings.ToLower(strings.TrimSuffix(host, "."))], true
+}
+
+// Get returns the bucket with the given route ID, or nil
+func (reg *bucketRegistry) Get(id string) *Bucket {
+	return reg.byID[id]
+}
+
+// prefixedStore confines an ObjectStore to the keys under root. Keys passed in
+// and returned are relative to root.
+type prefixedStore struct {
+	ObjectStore
+	root string
+}
+
+// List implements ObjectStore
+func (p *prefixedStore) List(ctx context.Context, opts ListOptions) (*ListPage, error) {
+	// Continuation tokens are opaque and passed through unchanged
+	opts.Prefix = p.root + opts.Prefix
+	if opts.StartAfter != "" {
+		opts.StartAfter = p.root + opts.StartAfter
+	}
+	page, err := p.ObjectStore.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.CommonPrefixes {
+		page.CommonPrefixes[i] = strings.TrimPrefix(page.CommonPrefixes[i], p.root)
+	}
+	for i := range page.Objects {
+		page.Objects[i].Key = strings.TrimPrefix(page.Objects[i].Key, p.root)
+	}
+	return page, nil
+}
+
+// ListVersions implements versionLister when the wrapped store does
+func (p *prefixedStore) ListVersions(ctx context.Context, opts ListOptions) (*VersionPage, error) {
+	opts.Prefix = p.root + opts.Prefix
+	if opts.StartAfter != "" {
+		opts.StartAfter = p.root + opts.StartAfter
+	}
+	page, err := listVersions(ctx, p.ObjectStore, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.CommonPrefixes {
+		page.CommonPrefixes[i] = strings.TrimPrefix(page.CommonPrefixes[i], p.root)
+	}
+	for i := range page.Versions {
+		page.Versions[i].Key = strings.TrimPrefix(page.Versions[i].Key, p.root)
+	}
+	return page, nil
+}
+
+// Head implements ObjectStore
+func (p *prefixedStore) Head(ctx context.Context, key string) (*ObjectResponse, error) {
+	return p.ObjectStore.Head(ctx, p.root+key)
+}
+
+// Get implements ObjectStore
+func (p *prefixedStore) Get(ctx context.Context, key string, opts GetOptions) (*ObjectResponse, error) {
+	return p.ObjectStore.Get(ctx, p.root+key, opts)
+}
+
+// URL implements ObjectStore
+func (p *prefixedStore) URL(key string) string {
+	return p.ObjectStore.URL(p.root + key)
+}
+
+// handleLanding renders the list of configured buckets
+func handleLanding(w http.ResponseWriter, reg *bucketRegistry, tmpl *template.Template) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.ExecuteTemplate(w, "landing", reg); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, err := fmt.Fprintf(w, "Error rendering template: %v\n", err); err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// handleNotFound renders the 404 page with the given message
+func handleNotFound(w http.ResponseWriter, message string, tmpl *template.Template) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	if err := tmpl.ExecuteTemplate(w, "notfound", message); err != nil {
+		fmt.Printf("Error rendering template: %v\n", err)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configStoreName is the Fastly Config Store holding the service settings,
+// and secretStoreName the Fastly Secret Store holding bucket credentials. In
+// standalone mode the same keys are read from environment variables with an
+// S3BROWSER_ prefix, e.g. S3BROWSER_BUCKET.
+const (
+	configStoreName = "s3browser"
+	secretStoreName = "s3browser"
+)
+
+const (
+	defaultBackend      = "TheOrigin"
+	defaultTitle        = "Open Data Browser"
+	defaultMaxListItems = 100000
+
+	defaultCacheTTL          = time.Minute
+	defaultCacheStaleRefresh = 5 * time.Minute
+	defaultCacheStaleOnError = time.Hour
+	defaultSummaryTTL        = time.Hour
+
+	defaultArchiveMaxBytes   = 10 << 30
+	defaultArchiveMaxObjects = 10000
+)
+
+// builtinSettings are the settings the service had compiled in before they
+// were configurable. Fastly services deployed without the s3browser Config
+// Store keep serving this bucket rather than failing every request.
+var builtinSettings = map[string]string{
+	"bucket":   "geonet-open-data",
+	"region":   "ap-southeast-2",
+	"endpoint": "https://s3-ap-southeast-2.amazonaws.com",
+	"title":    "Geonet Open Data Browser",
+}
+
+// Config holds the service settings
+type Config struct {
+	Title   string // landing page title when several buckets are configured
+	Buckets []BucketConfig
+	Hosts   map[string]string // request hostname to bucket ID, empty to disable host routing
+}
+
+// BucketConfig holds the settings for a single bucket being browsed
+type BucketConfig struct {
+	ID       string // route name, the bucket is served under /b/<ID>/
+	Bucket   string
+	Region   string // may be empty for S3-compatible stores with a custom endpoint
+	Endpoint string // S3 service endpoint, e.g. https://s3.ap-southeast-2.amazonaws.com
+	Backend  string // Fastly backend name used for this bucket
+	Title    string
+	Prefix   string // root prefix, nothing outside of it is browsable
+	ListAPI  string // "v2" (ListObjectsV2, the default) or "v1" (legacy ListObjects)
+
+	// PathStyle addresses the bucket as <endpoint>/<bucket> instead of
+	// <bucket>.<endpoint host>, as needed by MinIO, Ceph and similar stores
+	PathStyle bool
+
+	// MaxListItems caps listings fetched in full for sorting by date or size
+	MaxListItems int
+
+	// Cache controls how long listing pages are kept at the edge
+	Cache cachePolicy
+
+	// SummaryTTL is how long folder summaries are cached; 0 disables caching
+	SummaryTTL time.Duration
+
+	// ArchiveMaxBytes and ArchiveMaxObjects limit folder downloads
+	ArchiveMaxBytes   int64
+	ArchiveMaxObjects int
+
+	// Credentials sign requests for private buckets; zero for anonymous access
+	Credentials awsCredentials
+}
+
+// configLookup returns the value of a configuration key and whether it is set
+type configLookup func(key string) (string, bool)
+
+var (
+	bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	bucketIDPattern   = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+)
+
+// loadConfig reads and validates the configuration.
+//
+// A single bucket is configured with the unprefixed keys (bucket, region,
+// endpoint, path_style, backend, title, prefix, list_api, max_list_items,
+// cache_ttl, cache_stale_while_revalidate, cache_stale_if_error, summary_ttl,
+// archive_max_bytes, archive_max_objects). Several buckets are configured by
+// listing their route IDs in "buckets", e.g. "geonet-open-data,other", and
+// prefixing each bucket's keys with its ID and an underscore, e.g.
+// "other_bucket".
+//
+// Limits such as max_list_items, the cache durations and the archive limits
+// may also be set once without an ID prefix to apply to every bucket.
+// Credentials (access_key_id, secret_access_key, session_token) follow the
+// same naming but are read through secrets.
+func loadConfig(lookup, secrets configLookup) (Config, error) {
+	get := func(key string) string {
+		v, _ := lookup(key)
+		return strings.TrimSpace(v)
+	}
+	getSecret := func(key string) string {
+		v, _ := secrets(key)
+		return strings.TrimSpace(v)
+	}
+
+	cfg, err := loadBuckets(get, getSecret)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Hosts, err = parseHosts(get("hosts"), cfg.Buckets)
+	if err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadBuckets reads the title and the bucket list
+func loadBuckets(get, getSecret func(string) string) (Config, error) {
+	ids := get("buckets")
+	if ids == "" {
+		b, err := loadBucketConfig(get, getSecret, "")
+		if err != nil {
+			return Config{}, err
+		}
+		return Config{Title: b.Title, Buckets: []BucketConfig{b}}, nil
+	}
+
+	cfg := Config{Title: get("title")}
+	if cfg.Title == "" {
+		cfg.Title = defaultTitle
+	}
+	seen := map[string]bool{}
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if !bucketIDPattern.MatchString(id) {
+			return Config{}, fmt.Errorf("invalid bucket ID %q in %q", id, "buckets")
+		}
+		if seen[id] {
+			return Config{}, fmt.Errorf("duplicate bucket ID %q in %q", id, "buckets")
+		}
+		seen[id] = true
+		b, err := loadBucketConfig(get, getSecret, id)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.Buckets = append(cfg.Buckets, b)
+	}
+	if len(cfg.Buckets) == 0 {
+		return Config{}, fmt.Errorf("no bucket IDs listed in %q", "buckets")
+	}
+	return cfg, nil
+}
+
+// parseHosts parses the "hosts" setting, a comma-separated list of
+// hostname=bucket-id pairs, e.g. "data.example.org=geonet-open-data"
+func parseHosts(value string, buckets []BucketConfig) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(buckets))
+	for _, b := range buckets {
+		known[b.ID] = true
+	}
+	hosts := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		host, id, ok := strings.Cut(pair, "=")
+		host, id = strings.ToLower(strings.TrimSpace(host)), strings.TrimSpace(id)
+		if !ok || host == "" || id == "" {
+			return nil, fmt.Errorf("invalid entry %q in %q: want hostname=bucket-id", pair, "hosts")
+		}
+		if !known[id] {
+			return nil, fmt.Errorf("unknown bucket ID %q for host %q in %q", id, host, "hosts")
+		}
+		if _, dup := hosts[host]; dup {
+			return nil, fmt.Errorf("duplicate host %q in %q", host, "hosts")
+		}
+		hosts[host] = id
+	}
+	return hosts, nil
+}
+
+// loadBucketConfig reads the settings of one bucket. An empty id reads the
+// unprefixed single-bucket keys.
+func loadBucketConfig(get, getSecret func(string) string, id string) (BucketConfig, error) {
+	key := func(name string) string {
+		if id == "" {
+			return name
+		}
+		return id + "_" + name
+	}
+	// setting reads a per-bucket value, falling back to the unprefixed key
+	setting := func(name string) (string, string) {
+		if v := get(key(name)); v != "" || id == "" {
+			return v, key(name)
+		}
+		return get(name), name
+	}
+
+	cfg := BucketConfig{
+		ID:       id,
+		Bucket:   get(key("bucket")),
+		Region:   get(key("region")),
+		Endpoint: strings.TrimSuffix(get(key("endpoint")), "/"),
+		Backend:  get(key("backend")),
+		Title:    get(key("title")),
+		Prefix:   strings.TrimPrefix(get(key("prefix")), "/"),
+		ListAPI:  strings.ToLower(get(key("list_api"))),
+		Credentials: awsCredentials{
+			AccessKeyID:     getSecret(key("access_key_id")),
+			SecretAccessKey: getSecret(key("secret_access_key")),
+			SessionToken:    getSecret(key("session_token")),
+		},
+	}
+
+	if cfg.Bucket == "" {
+		return BucketConfig{}, fmt.Errorf("missing required setting %q", key("bucket"))
+	}
+	if !bucketNamePattern.MatchString(cfg.Bucket) {
+		return BucketConfig{}, fmt.Errorf("invalid bucket name %q in %q", cfg.Bucket, key("bucket"))
+	}
+	if cfg.Region == "" && cfg.Endpoint == "" {
+		return BucketConfig{}, fmt.Errorf("missing required setting %q (only optional with a custom %q)", key("region"), key("endpoint"))
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	switch pathStyle := strings.ToLower(get(key("path_style"))); pathStyle {
+	case "", "false", "0", "no":
+	case "true", "1", "yes":
+		cfg.PathStyle = true
+	default:
+		return BucketConfig{}, fmt.Errorf("invalid boolean %q in %q", pathStyle, key("path_style"))
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		return BucketConfig{}, fmt.Errorf("invalid endpoint %q in %q: must be an http(s) URL without a path", cfg.Endpoint, key("endpoint"))
+	}
+	if (cfg.Credentials.AccessKeyID == "") != (cfg.Credentials.SecretAccessKey == "") {
+		return BucketConfig{}, fmt.Errorf("%q and %q must be set together", key("access_key_id"), key("secret_access_key"))
+	}
+	switch cfg.ListAPI {
+	case "":
+		cfg.ListAPI = "v2"
+	case "v1", "v2":
+	default:
+		return BucketConfig{}, fmt.Errorf("invalid list API %q in %q: want v1 or v2", cfg.ListAPI, key("list_api"))
+	}
+	if v, k := setting("max_list_items"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return BucketConfig{}, fmt.Errorf("invalid positive integer %q in %q", v, k)
+		}
+		cfg.MaxListItems = n
+	}
+	cfg.ArchiveMaxObjects = defaultArchiveMaxObjects
+	if v, k := setting("archive_max_objects"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return BucketConfig{}, fmt.Errorf("invalid positive integer %q in %q", v, k)
+		}
+		cfg.ArchiveMaxObjects = n
+	}
+	cfg.ArchiveMaxBytes = defaultArchiveMaxBytes
+	if v, k := setting("archive_max_bytes"); v != "" {
+		n, err := parseFilterSize(v)
+		if err != nil || n < 1 {
+			return BucketConfig{}, fmt.Errorf("invalid size %q in %q: want bytes or e.g. 10GB", v, k)
+		}
+		cfg.ArchiveMaxBytes = n
+	}
+	cfg.Cache = cachePolicy{
+		TTL:                  defaultCacheTTL,
+		StaleWhileRevalidate: defaultCacheStaleRefresh,
+		StaleIfError:         defaultCacheStaleOnError,
+	}
+	cfg.SummaryTTL = defaultSummaryTTL
+	for name, d := range map[string]*time.Duration{
+		"cache_ttl":                    &cfg.Cache.TTL,
+		"cache_stale_while_revalidate": &cfg.Cache.StaleWhileRevalidate,
+		"cache_stale_if_error":         &cfg.Cache.StaleIfError,
+		"summary_ttl":                  &cfg.SummaryTTL,
+	} {
+		v, k := setting(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			return BucketConfig{}, fmt.Errorf("invalid duration %q in %q: want e.g. 30s or 5m", v, k)
+		}
+		*d = parsed
+	}
+	if cfg.ID == "" {
+		cfg.ID = cfg.Bucket
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = defaultBackend
+	}
+	if cfg.Title == "" {
+		cfg.Title = cfg.Bucket
+	}
+	if cfg.Prefix != "" && !strings.HasSuffix(cfg.Prefix, "/") {
+		cfg.Prefix += "/"
+	}
+
+	return cfg, nil
+}
+
+// BucketURL returns the base URL of the bucket, path-style or virtual-hosted
+func (c BucketConfig) BucketURL() string {
+	if c.PathStyle {
+		return c.Endpoint + "/" + c.Bucket
+	}
+	u, _ := url.Parse(c.Endpoint)
+	return fmt.Sprintf("%s://%s.%s", u.Scheme, c.Bucket, u.Host)
+}
+
+// SigningRegion returns the region used in SigV4 signatures. S3-compatible
+// stores without regions conventionally accept us-east-1.
+func (c BucketConfig) SigningRegion() string {
+	if c.Region == "" {
+		return "us-east-1"
+	}
+	return c.Region
+}
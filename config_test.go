@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mapLookup(m map[string]string) configLookup {
+	return func(key string) (string, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cases := []struct {
+		name      string
+		values    map[string]string
+		bucketURL string
+		err       string
+	}{
+		{
+			name:      "default endpoint",
+			values:    map[string]string{"bucket": "geonet-open-data", "region": "ap-southeast-2"},
+			bucketURL: "https://geonet-open-data.s3.ap-southeast-2.amazonaws.com",
+		},
+		{
+			name:      "custom endpoint",
+			values:    map[string]string{"bucket": "geonet-open-data", "region": "ap-southeast-2", "endpoint": "https://s3-ap-southeast-2.amazonaws.com/"},
+			bucketURL: "https://geonet-open-data.s3-ap-southeast-2.amazonaws.com",
+		},
+		{
+			name:      "path style without region",
+			values:    map[string]string{"bucket": "data", "endpoint": "http://minio.local:9000", "path_style": "true"},
+			bucketURL: "http://minio.local:9000/data",
+		},
+		{
+			name:      "virtual hosted custom endpoint",
+			values:    map[string]string{"bucket": "data", "endpoint": "https://ceph.example.org"},
+			bucketURL: "https://data.ceph.example.org",
+		},
+		{
+			name:      "built-in settings",
+			values:    builtinSettings,
+			bucketURL: "https://geonet-open-data.s3-ap-southeast-2.amazonaws.com",
+		},
+		{name: "invalid path style", values: map[string]string{"bucket": "data", "region": "x", "path_style": "maybe"}, err: "invalid boolean"},
+		{name: "missing bucket", values: map[string]string{"region": "ap-southeast-2"}, err: `"bucket"`},
+		{name: "missing region", values: map[string]string{"bucket": "geonet-open-data"}, err: `"region"`},
+		{name: "invalid bucket", values: map[string]string{"bucket": "Not_A_Bucket", "region": "x"}, err: "invalid bucket name"},
+		{name: "invalid max list items", values: map[string]string{"bucket": "abc", "region": "x", "max_list_items": "0"}, err: "invalid positive integer"},
+		{name: "invalid archive size", values: map[string]string{"bucket": "abc", "region": "x", "archive_max_bytes": "lots"}, err: "invalid size"},
+		{name: "invalid cache ttl", values: map[string]string{"bucket": "abc", "region": "x", "cache_ttl": "soon"}, err: "invalid duration"},
+		{name: "invalid endpoint", values: map[string]string{"bucket": "abc", "region": "x", "endpoint": "ftp://host"}, err: "invalid endpoint"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, err := loadConfig(mapLookup(c.values), mapLookup(nil))
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("loadConfig error = %v, want error containing %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if got := cfg.Buckets[0].BucketURL(); got != c.bucketURL {
+				t.Errorf("BucketURL() = %q, want %q", got, c.bucketURL)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMultipleBuckets(t *testing.T) {
+	cfg, err := loadConfig(mapLookup(map[string]string{
+		"title":                     "Open Data",
+		"buckets":                   "geonet-open-data, other",
+		"geonet-open-data_bucket":   "geonet-open-data",
+		"geonet-open-data_region":   "ap-southeast-2",
+		"other_bucket":              "other-bucket",
+		"other_region":              "us-east-1",
+		"other_backend":             "OtherOrigin",
+		"other_title":               "Other Data",
+		"other_prefix":              "/public",
+		"max_list_items":            "5000",
+		"other_max_list_items":      "10",
+		"cache_ttl":                 "30s",
+		"other_cache_ttl":           "0",
+		"other_summary_ttl":         "24h",
+		"archive_max_bytes":         "2GB",
+		"other_archive_max_objects": "50",
+	}), mapLookup(nil))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Title != "Open Data" || len(cfg.Buckets) != 2 {
+		t.Fatalf("loadConfig = %+v, want title and two buckets", cfg)
+	}
+	first, second := cfg.Buckets[0], cfg.Buckets[1]
+	if first.ID != "geonet-open-data" || first.Backend != defaultBackend || first.Title != "geonet-open-data" {
+		t.Errorf("first bucket = %+v, want defaults applied", first)
+	}
+	if first.MaxListItems != 5000 || second.MaxListItems != 10 {
+		t.Errorf("MaxListItems = %d, %d, want the global default then the override", first.MaxListItems, second.MaxListItems)
+	}
+	if first.Cache.TTL != 30*time.Second || second.Cache.TTL != 0 || first.Cache.StaleIfError != defaultCacheStaleOnError {
+		t.Errorf("Cache = %+v, %+v", first.Cache, second.Cache)
+	}
+	if first.SummaryTTL != defaultSummaryTTL || second.SummaryTTL != 24*time.Hour {
+		t.Errorf("SummaryTTL = %v, %v", first.SummaryTTL, second.SummaryTTL)
+	}
+	if first.ArchiveMaxBytes != 2<<30 || first.ArchiveMaxObjects != defaultArchiveMaxObjects || second.ArchiveMaxObjects != 50 {
+		t.Errorf("archive limits = %d/%d, %d/%d", first.ArchiveMaxBytes, first.ArchiveMaxObjects, second.ArchiveMaxBytes, second.ArchiveMaxObjects)
+	}
+	if second.ID != "other" || second.Backend != "OtherOrigin" || second.Title != "Other Data" || second.Prefix != "public/" {
+		t.Errorf("second bucket = %+v", second)
+	}
+
+	if _, err := loadConfig(mapLookup(map[string]string{"buckets": "missing"}), mapLookup(nil)); err == nil || !strings.Contains(err.Error(), `"missing_bucket"`) {
+		t.Errorf("loadConfig with incomplete bucket error = %v, want missing_bucket", err)
+	}
+}
+
+func TestLoadConfigHosts(t *testing.T) {
+	values := map[string]string{
+		"buckets":     "data,archive",
+		"data_bucket": "data-bucket", "data_region": "ap-southeast-2",
+		"archive_bucket": "archive-bucket", "archive_region": "ap-southeast-2",
+		"hosts": "Data.Example.org=data, archive.example.org=archive",
+	}
+	cfg, err := loadConfig(mapLookup(values), mapLookup(nil))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Hosts["data.example.org"] != "data" || cfg.Hosts["archive.example.org"] != "archive" {
+		t.Errorf("Hosts = %v", cfg.Hosts)
+	}
+
+	values["hosts"] = "data.example.org=nope"
+	if _, err := loadConfig(mapLookup(values), mapLookup(nil)); err == nil || !strings.Contains(err.Error(), `unknown bucket ID "nope"`) {
+		t.Errorf("loadConfig with unknown host bucket error = %v", err)
+	}
+}
+
+func TestLoadConfigCredentials(t *testing.T) {
+	values := map[string]string{"bucket": "private-bucket", "region": "ap-southeast-2"}
+
+	cfg, err := loadConfig(mapLookup(values), mapLookup(map[string]string{
+		"access_key_id":     "AKID",
+		"secret_access_key": "secret",
+	}))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if creds := cfg.Buckets[0].Credentials; creds.AccessKeyID != "AKID" || creds.SecretAccessKey != "secret" {
+		t.Errorf("Credentials = %+v", creds)
+	}
+
+	_, err = loadConfig(mapLookup(values), mapLookup(map[string]string{"access_key_id": "AKID"}))
+	if err == nil || !strings.Contains(err.Error(), "must be set together") {
+		t.Errorf("loadConfig with partial credentials error = %v", err)
+	}
+}
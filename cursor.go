@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// maxCursorHistory bounds how many earlier pages a cursor remembers for its
+// "previous" link, which keeps the URLs short. Going back past the oldest
+// remembered page lands on the first page.
+const maxCursorHistory = 16
+
+// listCursor is the position of a name-ascending listing page. It is passed
+// around as an opaque URL-safe token.
+type listCursor struct {
+	After string   `json:"a,omitempty"` // list entries after this key
+	Back  []string `json:"b,omitempty"` // After values of the earlier pages, oldest first
+}
+
+// decodeCursor parses a cursor token; an empty token is the first page
+func decodeCursor(token string) (listCursor, error) {
+	var c listCursor
+	if token == "" {
+		return c, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor: %v", err)
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, fmt.Errorf("invalid cursor: %v", err)
+	}
+	return c, nil
+}
+
+// Encode returns the cursor token; the first page encodes as ""
+func (c listCursor) Encode() string {
+	if c.After == "" && len(c.Back) == 0 {
+		return ""
+	}
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Next returns the cursor of the page following the one that ended at last
+func (c listCursor) Next(last string) listCursor {
+	back := append(append([]string{}, c.Back...), c.After)
+	if len(back) > maxCursorHistory {
+		back = back[len(back)-maxCursorHistory:]
+	}
+	return listCursor{After: last, Back: back}
+}
+
+// Prev returns the cursor of the preceding page
+func (c listCursor) Prev() listCursor {
+	if len(c.Back) == 0 {
+		return listCursor{}
+	}
+	n := len(c.Back) - 1
+	return listCursor{After: c.Back[n], Back: c.Back[:n]}
+}
+
+// IsFirst reports whether the cursor points at the first page
+func (c listCursor) IsFirst() bool {
+	return c.After == ""
+}
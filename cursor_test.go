@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestListCursorRoundTrip(t *testing.T) {
+	var c listCursor
+	if c.Encode() != "" {
+		t.Errorf("first page cursor = %q, want empty", c.Encode())
+	}
+
+	second := c.Next("data/b.csv")
+	third, err := decodeCursor(second.Next("data/d.csv").Encode())
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if third.After != "data/d.csv" {
+		t.Errorf("third.After = %q", third.After)
+	}
+	if prev := third.Prev(); prev.After != "data/b.csv" || prev.Prev().Encode() != "" {
+		t.Errorf("Prev() = %+v, want the second then the first page", prev)
+	}
+
+	if _, err := decodeCursor("not a cursor!"); err == nil {
+		t.Error("decodeCursor accepted a malformed token")
+	}
+}
+
+func TestListCursorHistoryIsBounded(t *testing.T) {
+	var c listCursor
+	for i := 0; i < maxCursorHistory+5; i++ {
+		c = c.Next(string(rune('a' + i)))
+	}
+	if len(c.Back) != maxCursorHistory {
+		t.Errorf("len(Back) = %d, want %d", len(c.Back), maxCursorHistory)
+	}
+}
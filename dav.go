@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// davAllow lists the methods of the read-only WebDAV frontend
+const davAllow = "OPTIONS, GET, HEAD, PROPFIND"
+
+// maxPropfindBody bounds the PROPFIND request body that is read and ignored
+const maxPropfindBody = 64 << 10
+
+// davMultistatus is a WebDAV 207 Multi-Status response body (RFC 4918). The
+// children carry no namespace of their own and so inherit DAV:.
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"DAV: multistatus"`
+	Responses []davResponse `xml:"response"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"href"`
+	Propstat davPropstat `xml:"propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"prop"`
+	Status string  `xml:"status"`
+}
+
+type davProp struct {
+	DisplayName      string          `xml:"displayname"`
+	ResourceType     davResourceType `xml:"resourcetype"`
+	GetContentLength string          `xml:"getcontentlength,omitempty"`
+	GetContentType   string          `xml:"getcontenttype,omitempty"`
+	GetLastModified  string          `xml:"getlastmodified,omitempty"`
+	GetETag          string          `xml:"getetag,omitempty"`
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"collection"`
+}
+
+// davError is the body of a WebDAV precondition failure
+type davError struct {
+	XMLName   xml.Name  `xml:"DAV: error"`
+	Condition *struct{} `xml:"propfind-finite-depth"`
+}
+
+// handleDAV serves the read-only WebDAV frontend under dav/. Folders are
+// collections and objects are resources; GET and HEAD go to the file proxy.
+// davPath is the request path below dav, starting with a slash.
+func handleDAV(ctx context.Context, w http.ResponseWriter, r *http.Request, b bucketView, davPath string) error {
+	key := strings.TrimPrefix(davPath, "/")
+	href := func(key string) string {
+		return (&url.URL{Path: b.BasePath + toolNamespace + "dav/" + key}).EscapedPath()
+	}
+
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("DAV", "1")
+		w.Header().Set("Allow", davAllow)
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case "GET", "HEAD":
+		if key == "" || strings.HasSuffix(key, "/") {
+			// Collections have no content; browsers get the folder page
+			if r.Method == "GET" {
+				http.Redirect(w, r, b.BasePath+"?prefix="+url.QueryEscape(key), http.StatusFound)
+			}
+			return nil
+		}
+		if r.Method == "HEAD" {
+			return handleFileHead(ctx, w, b.Store, key)
+		}
+		return handleFileRequest(ctx, w, b.Store, key, GetOptions{Range: r.Header.Get("Range")})
+	case "PROPFIND":
+	default:
+		w.Header().Set("Allow", davAllow)
+		writeErrorf(w, http.StatusMethodNotAllowed, "Method not allowed: this WebDAV share is read-only\n")
+		return fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	depth := r.Header.Get("Depth")
+	if depth != "0" && depth != "1" {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		return writeDAVXML(w, davError{Condition: &struct{}{}})
+	}
+	// The requested properties are ignored: every known property is returned
+	if _, err := io.Copy(io.Discard, io.LimitReader(r.Body, maxPropfindBody)); err != nil {
+		writeErrorf(w, http.StatusBadRequest, "Error reading request body: %v\n", err)
+		return err
+	}
+
+	var ms davMultistatus
+	if key != "" && !strings.HasSuffix(key, "/") {
+		// A file, or a folder named without its trailing slash
+		resp, err := b.Store.Head(ctx, key)
+		if err != nil {
+			writeErrorf(w, http.StatusBadGateway, "Error fetching from S3: %v\n", err)
+			return err
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			ms.Responses = append(ms.Responses, davFileResponse(href(key), key, resp.Header))
+			return writeMultistatus(w, ms)
+		}
+		key += "/"
+	}
+
+	prefixes, objects, err := davChildren(ctx, b.Store, key, b.maxListItems())
+	if err != nil {
+		writeErrorf(w, http.StatusInternalServerError, "Error listing objects: %v\n", err)
+		return err
+	}
+	if key != "" && len(prefixes) == 0 && len(objects) == 0 {
+		writeErrorf(w, http.StatusNotFound, "Not found: %s\n", key)
+		return fmt.Errorf("%s not found", key)
+	}
+	ms.Responses = append(ms.Responses, davCollectionResponse(href(key), key))
+	if depth == "1" {
+		for _, p := range prefixes {
+			ms.Responses = append(ms.Responses, davCollectionResponse(href(p), p))
+		}
+		for _, o := range objects {
+			h := http.Header{}
+			h.Set("Content-Length", strconv.FormatInt(o.Size, 10))
+			h.Set("Last-Modified", o.LastModified.UTC().Format(http.TimeFormat))
+			if o.ETag != "" {
+				h.Set("ETag", o.ETag)
+			}
+			ms.Responses = append(ms.Responses, davFileResponse(href(o.Key), o.Key, h))
+		}
+	}
+	return writeMultistatus(w, ms)
+}
+
+// davChildren lists the folders and files directly under prefix, stopping
+// after maxItems entries
+func davChildren(ctx context.Context, store ObjectStore, prefix string, maxItems int) (prefixes []string, objects []ObjectInfo, err error) {
+	opts := ListOptions{Prefix: prefix, Delimiter: "/"}
+	for {
+		page, err := store.List(ctx, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		prefixes = append(prefixes, page.CommonPrefixes...)
+		for _, o := range page.Objects {
+			// Skip the folder's own zero-byte marker
+			if o.Key != prefix {
+				objects = append(objects, o)
+			}
+		}
+		if page.NextToken == "" || len(prefixes)+len(objects) >= maxItems {
+			return prefixes, objects, nil
+		}
+		opts.Token = page.NextToken
+	}
+}
+
+func davCollectionResponse(href, key string) davResponse {
+	return davResponse{
+		Href: href,
+		Propstat: davPropstat{
+			Prop: davProp{
+				DisplayName:  path.Base("/" + key),
+				ResourceType: davResourceType{Collection: &struct{}{}},
+			},
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+}
+
+// davFileResponse describes a file from its HEAD or listing headers
+func davFileResponse(href, key string, h http.Header) davResponse {
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	modified := ""
+	if t, err := http.ParseTime(h.Get("Last-Modified")); err == nil {
+		modified = t.UTC().Format(http.TimeFormat)
+	}
+	return davResponse{
+		Href: href,
+		Propstat: davPropstat{
+			Prop: davProp{
+				DisplayName:      path.Base(key),
+				GetContentLength: h.Get("Content-Length"),
+				GetContentType:   contentType,
+				GetLastModified:  modified,
+				GetETag:          h.Get("ETag"),
+			},
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+}
+
+func writeMultistatus(w http.ResponseWriter, ms davMultistatus) error {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	return writeDAVXML(w, ms)
+}
+
+func writeDAVXML(w http.ResponseWriter, v any) error {
+	if _, err := fmt.Fprint(w, xml.Header); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// handleFileHead answers a HEAD request for a file with the origin's headers
+func handleFileHead(ctx context.Context, w http.ResponseWriter, store ObjectStore, fileKey string) error {
+	resp, err := store.Head(ctx, fileKey)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return err
+	}
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	return nil
+}
+
+// isDAVMethod reports whether method is only served by the WebDAV frontend
+func isDAVMethod(method string) bool {
+	return method == "OPTIONS" || method == "PROPFIND" || method == "HEAD"
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// davClientResponse is a multistatus response entry as a WebDAV client reads
+// it, matching elements by the DAV: namespace
+type davClientResponse struct {
+	Href string `xml:"DAV: href"`
+	Prop struct {
+		DisplayName   string `xml:"DAV: displayname"`
+		ContentLength string `xml:"DAV: getcontentlength"`
+		LastModified  string `xml:"DAV: getlastmodified"`
+		ETag          string `xml:"DAV: getetag"`
+		ResourceType  struct {
+			Collection *struct{} `xml:"DAV: collection"`
+		} `xml:"DAV: resourcetype"`
+	} `xml:"DAV: propstat>prop"`
+}
+
+func propfind(t *testing.T, url, depth string) (int, []davClientResponse) {
+	t.Helper()
+	req, _ := http.NewRequest("PROPFIND", url, strings.NewReader(`<?xml version="1.0"?><propfind xmlns="DAV:"><allprop/></propfind>`))
+	if depth != "" {
+		req.Header.Set("Depth", depth)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PROPFIND %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusMultiStatus {
+		return resp.StatusCode, nil
+	}
+	var ms struct {
+		Responses []davClientResponse `xml:"DAV: response"`
+	}
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		t.Fatalf("parsing multistatus: %v\n%s", err, body)
+	}
+	return resp.StatusCode, ms.Responses
+}
+
+func TestDAV(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/a b.csv":   "abc",
+		"data/sub/c.csv": "c",
+		"top.txt":        "top",
+	})
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("OPTIONS", srv.URL+"/_/dav/", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("DAV") != "1" || resp.Header.Get("Allow") != davAllow {
+		t.Errorf("OPTIONS headers = %v", resp.Header)
+	}
+
+	status, rs := propfind(t, srv.URL+"/_/dav/data/", "1")
+	if status != http.StatusMultiStatus || len(rs) != 3 {
+		t.Fatalf("PROPFIND depth 1 = %d %+v", status, rs)
+	}
+	if rs[0].Href != "/_/dav/data/" || rs[0].Prop.ResourceType.Collection == nil {
+		t.Errorf("collection = %+v", rs[0])
+	}
+	if rs[1].Href != "/_/dav/data/sub/" || rs[1].Prop.DisplayName != "sub" || rs[1].Prop.ResourceType.Collection == nil {
+		t.Errorf("sub-collection = %+v", rs[1])
+	}
+	file := rs[2]
+	if file.Href != "/_/dav/data/a%20b.csv" || file.Prop.ContentLength != "3" || file.Prop.ETag != fakeETag("abc") ||
+		file.Prop.LastModified != "Tue, 02 Jan 2024 03:04:05 GMT" || file.Prop.ResourceType.Collection != nil {
+		t.Errorf("file = %+v", file)
+	}
+
+	// Clients often name folders without the trailing slash
+	if status, rs = propfind(t, srv.URL+"/_/dav/data", "0"); status != http.StatusMultiStatus || len(rs) != 1 || rs[0].Href != "/_/dav/data/" {
+		t.Errorf("PROPFIND folder without slash = %d %+v", status, rs)
+	}
+	if status, rs = propfind(t, srv.URL+"/_/dav/top.txt", "0"); status != http.StatusMultiStatus || len(rs) != 1 || rs[0].Prop.DisplayName != "top.txt" {
+		t.Errorf("PROPFIND file = %d %+v", status, rs)
+	}
+	if status, _ = propfind(t, srv.URL+"/_/dav/missing", "0"); status != http.StatusNotFound {
+		t.Errorf("PROPFIND missing = %d, want 404", status)
+	}
+	if status, _ = propfind(t, srv.URL+"/_/dav/", ""); status != http.StatusForbidden {
+		t.Errorf("PROPFIND infinite depth = %d, want 403", status)
+	}
+
+	resp, err = http.Get(srv.URL + "/_/dav/data/a%20b.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "abc" {
+		t.Errorf("GET through WebDAV = %q", body)
+	}
+
+	for _, c := range []struct{ method, path string }{{"PUT", "/_/dav/new.txt"}, {"PROPFIND", "/data/"}, {"HEAD", "/"}} {
+		req, _ := http.NewRequest(c.method, srv.URL+c.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s = %d, want 405", c.method, c.path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// metalink is a Metalink 4 document (RFC 5854)
+type metalink struct {
+	XMLName   xml.Name       `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	Generator string         `xml:"generator"`
+	Published string         `xml:"published"`
+	Files     []metalinkFile `xml:"file"`
+}
+
+type metalinkFile struct {
+	Name   string         `xml:"name,attr"`
+	Size   int64          `xml:"size"`
+	Hashes []metalinkHash `xml:"hash,omitempty"`
+	URLs   []string       `xml:"url"`
+}
+
+// metalinkHash uses the IANA hash function names, e.g. md5 or sha-256
+type metalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// handleExport serves /_/export.meta4 and /_/export.txt, the files under
+// prefix as a Metalink 4 document for aria2 and other bulk downloaders, or as
+// a URL list for wget -i. URLs point at this site's file proxy rather than at
+// S3. Folders above max_list_items files are refused rather than cut short,
+// as a partial list would silently miss files.
+func handleExport(ctx context.Context, w http.ResponseWriter, r *http.Request, b bucketView, prefix, format string, tmpl *template.Template) error {
+	prefix = archivePrefix(prefix)
+	objects, err := startArchive(ctx, w, b, prefix, math.MaxInt64, b.maxListItems(), archiveExport, tmpl)
+	if objects == nil {
+		return err
+	}
+
+	base := requestBaseURL(r)
+	fileURL := func(key string) string {
+		return base + (&url.URL{Path: b.BasePath + key}).EscapedPath()
+	}
+	root := archiveRoot(b, prefix)
+
+	if format == "txt" {
+		setAttachment(w, "text/plain; charset=utf-8", root+"-urls.txt")
+		var sb strings.Builder
+		for _, o := range objects {
+			sb.WriteString(fileURL(o.Key) + "\n")
+		}
+		if _, err := io.WriteString(w, sb.String()); err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+			return err
+		}
+		return nil
+	}
+
+	doc := metalink{Generator: "go_s3browser", Published: time.Now().UTC().Format(time.RFC3339)}
+	for _, o := range objects {
+		// A downloader saves each file under its name, so one that would
+		// land outside the folder is left out
+		name, err := archiveEntryName(root, prefix, o.Key)
+		if err != nil {
+			continue
+		}
+		f := metalinkFile{
+			Name: name,
+			Size: o.Size,
+			URLs: []string{fileURL(o.Key)},
+		}
+		// Only single-part ETags are MD5s of the content
+		if sum, ok := etagMD5(o.ETag); ok {
+			f.Hashes = append(f.Hashes, metalinkHash{Type: "md5", Value: sum})
+		}
+		doc.Files = append(doc.Files, f)
+	}
+	setAttachment(w, "application/metalink4+xml", root+".meta4")
+	if _, err := fmt.Fprint(w, xml.Header); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/a b.csv":   "abc",
+		"data/sub/c.csv": "c",
+		"other.txt":      "other",
+	})
+	handler := newHandler(newTestRegistry(store), newTemplate())
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		return rec
+	}
+
+	rec := get("http://example.org/_/export.txt?prefix=data/")
+	want := "http://example.org/data/a%20b.csv\nhttp://example.org/data/sub/c.csv\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("URL list = %d %q, want %q", rec.Code, rec.Body, want)
+	}
+
+	rec = get("http://example.org/_/export.meta4?prefix=data")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/metalink4+xml" {
+		t.Fatalf("Metalink = %d %v", rec.Code, rec.Header())
+	}
+	// Read it back the way a downloader would, by namespace
+	var doc struct {
+		Files []struct {
+			Name string `xml:"name,attr"`
+			Size int64  `xml:"urn:ietf:params:xml:ns:metalink size"`
+			Hash struct {
+				Type  string `xml:"type,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"urn:ietf:params:xml:ns:metalink hash"`
+			URL string `xml:"urn:ietf:params:xml:ns:metalink url"`
+		} `xml:"urn:ietf:params:xml:ns:metalink file"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("parsing Metalink: %v\n%s", err, rec.Body)
+	}
+	if len(doc.Files) != 2 {
+		t.Fatalf("Metalink lists %d files, want 2:\n%s", len(doc.Files), rec.Body)
+	}
+	f := doc.Files[0]
+	if f.Name != "data/a b.csv" || f.Size != 3 || f.URL != "http://example.org/data/a%20b.csv" ||
+		f.Hash.Type != "md5" || f.Hash.Value != fmt.Sprintf("%x", md5.Sum([]byte("abc"))) {
+		t.Errorf("Metalink file = %+v", f)
+	}
+
+	// The listing page offers the exports
+	body := get("/?prefix=data/").Body.String()
+	for _, link := range []string{`href="/_/export.meta4?prefix=data%2f"`, `href="/_/export.txt?prefix=data%2f"`, `href="/_/zip?prefix=data%2f"`} {
+		if !strings.Contains(body, link) {
+			t.Errorf("listing has no %s", link)
+		}
+	}
+
+	reg := newBucketRegistry("Test", []*Bucket{{ID: "test", Title: "Test Bucket", Store: store, MaxListItems: 1}})
+	rec = httptest.NewRecorder()
+	newHandler(reg, newTemplate()).ServeHTTP(rec, httptest.NewRequest("GET", "/_/export.txt?prefix=data/", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("export above max_list_items = %d, want 403", rec.Code)
+	}
+	for _, want := range []string{"<h1>Export too large</h1>", "the most that can be exported at once", "Export a smaller folder"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("export error page has no %q:\n%s", want, rec.Body)
+		}
+	}
+}
+
+func TestExportLeavesOutEscapingKeys(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/ok.csv":       "ok",
+		"data/a/../../evil": "evil",
+	})
+	rec := httptest.NewRecorder()
+	newHandler(newTestRegistry(store), newTemplate()).ServeHTTP(rec, httptest.NewRequest("GET", "/_/export.meta4?prefix=data/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Metalink = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `name="data/ok.csv"`) || strings.Contains(body, "evil") {
+		t.Errorf("Metalink should list only data/ok.csv:\n%s", body)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFeedEntries bounds the limit parameter of a feed
+const maxFeedEntries = 500
+
+// atomFeed is an Atom 1.0 feed document (RFC 4287)
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Updated   string      `xml:"updated"`
+	Author    atomPerson  `xml:"author"`
+	Generator string      `xml:"generator"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Summary string     `xml:"summary"`
+}
+
+// feedUUID derives a stable urn:uuid from parts, as a name-based (version 5
+// style) UUID, so that feed readers recognise entries they have seen
+func feedUUID(parts ...string) string {
+	h := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	h[6] = h[6]&0x0f | 0x50
+	h[8] = h[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// requestBaseURL is the scheme and host the request was made to. Fastly
+// hands over absolute request URLs; net/http leaves the scheme empty.
+func requestBaseURL(r *http.Request) string {
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+	}
+	return scheme + "://" + r.Host
+}
+
+// recentObjects returns the n most recently modified files under prefix,
+// newest first, in sub-folders too when recursive. At most maxItems objects
+// are looked at.
+func recentObjects(ctx context.Context, store ObjectStore, prefix string, recursive bool, n, maxItems int) (recent []ObjectInfo, truncated bool, err error) {
+	newestFirst := func() {
+		sort.Slice(recent, func(i, j int) bool {
+			if !recent[i].LastModified.Equal(recent[j].LastModified) {
+				return recent[i].LastModified.After(recent[j].LastModified)
+			}
+			return recent[i].Key < recent[j].Key
+		})
+	}
+
+	opts := ListOptions{Prefix: prefix}
+	if !recursive {
+		opts.Delimiter = "/"
+	}
+	scanned := 0
+	for {
+		page, err := store.List(ctx, opts)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, o := range page.Objects {
+			if scanned == maxItems {
+				truncated = true
+				break
+			}
+			scanned++
+			if strings.HasSuffix(o.Key, "/") {
+				continue
+			}
+			recent = append(recent, o)
+		}
+		// Keep memory bounded on large prefixes
+		if len(recent) > 2*n {
+			newestFirst()
+			recent = recent[:n]
+		}
+		if truncated || page.NextToken == "" {
+			break
+		}
+		opts.Token = page.NextToken
+	}
+	newestFirst()
+	if len(recent) > n {
+		recent = recent[:n]
+	}
+	return recent, truncated, nil
+}
+
+// handleFeed serves /_/feed.atom, an Atom feed of the most recently modified
+// files under prefix. Entry IDs derive from the key and ETag, so a file that
+// is overwritten appears as a new entry. When more than MaxListItems objects
+// had to be looked at, the feed says so in its subtitle and the
+// X-Listing-Truncated header, as newer files may have been missed.
+func handleFeed(ctx context.Context, w http.ResponseWriter, r *http.Request, b bucketView, prefix string, limit int) error {
+	ctx, cacheStatus := withCacheStatus(ctx)
+
+	recursive, err := parseFilterToggle(r.URL.Query().Get("recursive"))
+	if err != nil {
+		writeErrorf(w, http.StatusBadRequest, "invalid recursive %q: want 1 or 0\n", r.URL.Query().Get("recursive"))
+		return err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	limit = min(limit, maxFeedEntries)
+
+	objects, truncated, err := recentObjects(ctx, b.Store, prefix, recursive, limit, b.maxListItems())
+	if err != nil {
+		writeErrorf(w, http.StatusInternalServerError, "Error listing objects: %v\n", err)
+		return err
+	}
+
+	base := requestBaseURL(r)
+	fileURL := func(key string) string {
+		return base + (&url.URL{Path: b.BasePath + key}).EscapedPath()
+	}
+	scope := "/" + prefix
+	if recursive {
+		scope += " and below"
+	}
+	feed := atomFeed{
+		ID:        feedUUID("feed", b.ID, prefix, strconv.FormatBool(recursive)),
+		Title:     fmt.Sprintf("%s: recently modified in %s", b.Title, scope),
+		Updated:   time.Now().UTC().Format(time.RFC3339),
+		Author:    atomPerson{Name: b.Title},
+		Generator: "go_s3browser",
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + r.URL.RequestURI()},
+			{Rel: "alternate", Type: "text/html", Href: base + b.BasePath + "?prefix=" + url.QueryEscape(prefix)},
+		},
+		Entries: make([]atomEntry, 0, len(objects)),
+	}
+	if truncated {
+		feed.Subtitle = fmt.Sprintf("Only the first %d objects in key order were looked at, so newer files may be missing.", b.maxListItems())
+	}
+	if len(objects) > 0 {
+		feed.Updated = objects[0].LastModified.UTC().Format(time.RFC3339)
+	}
+	for _, o := range objects {
+		version := o.ETag
+		if version == "" {
+			version = o.LastModified.UTC().Format(time.RFC3339Nano) + "/" + strconv.FormatInt(o.Size, 10)
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      feedUUID("entry", b.ID, o.Key, version),
+			Title:   o.Key,
+			Updated: o.LastModified.UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Rel: "alternate", Href: fileURL(o.Key), Length: o.Size},
+				{Rel: "related", Href: b.Store.URL(o.Key)},
+			},
+			Summary: fmt.Sprintf("%s, modified %s", formatSize(o.Size), o.LastModified.UTC().Format("2006-01-02 15:04:05")),
+		})
+	}
+
+	cacheStatus.SetHeader(w.Header())
+	if truncated {
+		w.Header().Set(listTruncatedHeader, "true")
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	if _, err := fmt.Fprint(w, xml.Header); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getFeed(t *testing.T, url string) atomFeed {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/atom+xml; charset=utf-8" {
+		t.Fatalf("GET %s = %d %s: %s", url, resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		t.Fatalf("parsing feed: %v\n%s", err, body)
+	}
+	return feed
+}
+
+func TestFeed(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	store := newFakeStore(map[string]string{
+		"wf/a.mseed":     "a",
+		"wf/b.mseed":     "b",
+		"wf/sub/c.mseed": "c",
+		"wf/old.mseed":   "old",
+	})
+	store.times = map[string]time.Time{"wf/a.mseed": day(2), "wf/b.mseed": day(3), "wf/sub/c.mseed": day(5), "wf/old.mseed": day(1)}
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	feed := getFeed(t, srv.URL+"/_/feed.atom?prefix=wf/&limit=2")
+	if len(feed.Entries) != 2 || feed.Entries[0].Title != "wf/b.mseed" || feed.Entries[1].Title != "wf/a.mseed" {
+		t.Fatalf("entries = %+v", feed.Entries)
+	}
+	if feed.Updated != "2025-01-03T00:00:00Z" || !strings.HasPrefix(feed.ID, "urn:uuid:") {
+		t.Errorf("feed header = %q %q", feed.ID, feed.Updated)
+	}
+	if link := feed.Entries[0].Links[0]; link.Href != srv.URL+"/wf/b.mseed" || link.Length != 1 {
+		t.Errorf("entry link = %+v", link)
+	}
+
+	recursive := getFeed(t, srv.URL+"/_/feed.atom?prefix=wf/&recursive=1&limit=2")
+	if len(recursive.Entries) != 2 || recursive.Entries[0].Title != "wf/sub/c.mseed" {
+		t.Errorf("recursive entries = %+v", recursive.Entries)
+	}
+	if recursive.ID == feed.ID {
+		t.Error("recursive and flat feeds share an ID")
+	}
+
+	// IDs are stable until the content changes
+	again := getFeed(t, srv.URL+"/_/feed.atom?prefix=wf/&limit=2")
+	store.objects["wf/a.mseed"] = "changed"
+	changed := getFeed(t, srv.URL+"/_/feed.atom?prefix=wf/&limit=2")
+	if again.Entries[1].ID != feed.Entries[1].ID || changed.Entries[1].ID == feed.Entries[1].ID || changed.Entries[0].ID != feed.Entries[0].ID {
+		t.Errorf("entry IDs = %s, %s, %s", feed.Entries[1].ID, again.Entries[1].ID, changed.Entries[1].ID)
+	}
+
+	resp, err := http.Get(srv.URL + "/?prefix=wf/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `<link rel="alternate" type="application/atom+xml" title="Recently modified in /wf/" href="/_/feed.atom?prefix=wf%2f">`) {
+		t.Error("browser page does not advertise the feed")
+	}
+}
+
+func TestFeedReportsTruncation(t *testing.T) {
+	files := map[string]string{}
+	for i := range 300 {
+		files[fmt.Sprintf("wf/%03d.mseed", i)] = "x"
+	}
+	files["other/a.mseed"] = "a"
+	store := newFakeStore(files)
+	store.pageSize = 100
+	store.times = map[string]time.Time{"wf/299.mseed": time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)}
+	reg := newBucketRegistry("Test", []*Bucket{{ID: "test", Title: "Test Bucket", Store: store, MaxListItems: 100}})
+	srv := httptest.NewServer(newHandler(reg, newTemplate()))
+	defer srv.Close()
+
+	url := srv.URL + "/_/feed.atom?prefix=wf/&recursive=1"
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	_ = resp.Body.Close()
+	if got := resp.Header.Get(listTruncatedHeader); got != "true" {
+		t.Errorf("%s = %q, want true", listTruncatedHeader, got)
+	}
+
+	feed := getFeed(t, url)
+	if !strings.Contains(feed.Subtitle, "Only the first 100 objects") {
+		t.Errorf("subtitle = %q, want a truncation notice", feed.Subtitle)
+	}
+	for _, e := range feed.Entries {
+		if e.Title == "wf/299.mseed" {
+			t.Errorf("entry %s lies past the cap", e.Title)
+		}
+	}
+
+	small := getFeed(t, srv.URL+"/_/feed.atom?prefix=other/")
+	if small.Subtitle != "" {
+		t.Errorf("untruncated feed subtitle = %q", small.Subtitle)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filterDateLayout is the date format of the modified_after and
+// modified_before filters
+const filterDateLayout = "2006-01-02"
+
+// sizeUnits are the suffixes accepted by the size filters, matching the
+// 1024-based units shown by formatSize
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// listFilter narrows a listing to the files matching every set condition.
+// Folders are always kept so that the filtered tree can still be navigated.
+type listFilter struct {
+	Exts          []string  // lower-case extensions without the dot
+	After, Before time.Time // modified at or after After and before Before
+	MinSize       int64     // -1 when unset
+	MaxSize       int64     // -1 when unset
+	Deleted       bool      // also list files whose latest version is a delete marker
+
+	// Summary is not a condition: it fills in folder sizes and dates, so
+	// that folders sort by them too
+	Summary bool
+
+	// Raw holds the submitted values so they can be shown and linked again,
+	// including invalid ones
+	Raw filterValues
+}
+
+// filterValues are the filter query parameters as submitted
+type filterValues struct {
+	Ext, After, Before, MinSize, MaxSize, Deleted, Summary string
+}
+
+// parseFilter reads the ext, modified_after, modified_before, minsize,
+// maxsize, deleted and summary parameters.
+// Invalid values are left out of the filter and reported in errs.
+func parseFilter(q url.Values) (f listFilter, errs []string) {
+	f = listFilter{MinSize: -1, MaxSize: -1, Raw: filterValues{
+		Ext:     strings.TrimSpace(q.Get("ext")),
+		After:   strings.TrimSpace(q.Get("modified_after")),
+		Before:  strings.TrimSpace(q.Get("modified_before")),
+		MinSize: strings.TrimSpace(q.Get("minsize")),
+		MaxSize: strings.TrimSpace(q.Get("maxsize")),
+		Deleted: strings.TrimSpace(q.Get("deleted")),
+		Summary: strings.TrimSpace(q.Get("summary")),
+	}}
+
+	for _, ext := range strings.Split(f.Raw.Ext, ",") {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext == "" {
+			continue
+		}
+		if strings.ContainsAny(ext, "/ ") {
+			errs = append(errs, fmt.Sprintf("Extension %q is not valid: use names such as csv or json, separated by commas.", ext))
+			continue
+		}
+		f.Exts = append(f.Exts, ext)
+	}
+
+	var err error
+	if f.After, err = parseFilterTime(f.Raw.After); err != nil {
+		errs = append(errs, fmt.Sprintf("Modified after %q is not a date: use YYYY-MM-DD.", f.Raw.After))
+	}
+	if f.Before, err = parseFilterTime(f.Raw.Before); err != nil {
+		errs = append(errs, fmt.Sprintf("Modified before %q is not a date: use YYYY-MM-DD.", f.Raw.Before))
+	}
+	if !f.After.IsZero() && !f.Before.IsZero() && !f.After.Before(f.Before) {
+		errs = append(errs, "Modified after must be earlier than modified before.")
+		f.After, f.Before = time.Time{}, time.Time{}
+	}
+
+	if f.MinSize, err = parseFilterSize(f.Raw.MinSize); err != nil {
+		errs = append(errs, fmt.Sprintf("Minimum size %q is not a size: use bytes or a unit such as 10MB.", f.Raw.MinSize))
+	}
+	if f.MaxSize, err = parseFilterSize(f.Raw.MaxSize); err != nil {
+		errs = append(errs, fmt.Sprintf("Maximum size %q is not a size: use bytes or a unit such as 10MB.", f.Raw.MaxSize))
+	}
+	if f.MinSize >= 0 && f.MaxSize >= 0 && f.MinSize > f.MaxSize {
+		errs = append(errs, "Minimum size must not be larger than maximum size.")
+		f.MinSize, f.MaxSize = -1, -1
+	}
+
+	if f.Deleted, err = parseFilterToggle(f.Raw.Deleted); err != nil {
+		errs = append(errs, fmt.Sprintf("Show deleted %q is not valid: use 1 or 0.", f.Raw.Deleted))
+	}
+	if f.Summary, err = parseFilterToggle(f.Raw.Summary); err != nil {
+		errs = append(errs, fmt.Sprintf("Folder sizes %q is not valid: use 1 or 0.", f.Raw.Summary))
+	}
+	return f, errs
+}
+
+// parseFilterToggle parses a checkbox parameter; an empty string is off
+func parseFilterToggle(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "", "0", "false", "off":
+		return false, nil
+	case "1", "true", "on":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid toggle %q", s)
+}
+
+// parseFilterTime parses a YYYY-MM-DD date (UTC) or an RFC 3339 timestamp
+func parseFilterTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(filterDateLayout, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseFilterSize parses a byte count with an optional unit, e.g. 1.5GB;
+// an empty string is -1
+func parseFilterSize(s string) (int64, error) {
+	if s == "" {
+		return -1, nil
+	}
+	lower := strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	i := strings.IndexFunc(lower, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(lower)
+	}
+	unit, ok := sizeUnits[lower[i:]]
+	if !ok || i == 0 {
+		return -1, fmt.Errorf("invalid size %q", s)
+	}
+	n, err := strconv.ParseFloat(lower[:i], 64)
+	if err != nil || n*float64(unit) > math.MaxInt64 {
+		return -1, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// Active reports whether any condition is set
+func (f listFilter) Active() bool {
+	return len(f.Exts) > 0 || !f.After.IsZero() || !f.Before.IsZero() || f.MinSize >= 0 || f.MaxSize >= 0 || f.Deleted
+}
+
+// Match reports whether o passes the filter
+func (f listFilter) Match(o S3Object) bool {
+	if o.IsDirectory {
+		return true
+	}
+	if len(f.Exts) > 0 {
+		ext := ""
+		if i := strings.LastIndex(o.Name, "."); i >= 0 {
+			ext = strings.ToLower(o.Name[i+1:])
+		}
+		found := false
+		for _, e := range f.Exts {
+			if e == ext {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.After.IsZero() && o.ModTime.Before(f.After) {
+		return false
+	}
+	if !f.Before.IsZero() && !o.ModTime.Before(f.Before) {
+		return false
+	}
+	if f.MinSize >= 0 && o.Size < f.MinSize {
+		return false
+	}
+	if f.MaxSize >= 0 && o.Size > f.MaxSize {
+		return false
+	}
+	return true
+}
+
+// Apply returns the objects passing the filter
+func (f listFilter) Apply(objects []S3Object) []S3Object {
+	if !f.Active() {
+		return objects
+	}
+	kept := objects[:0]
+	for _, o := range objects {
+		if f.Match(o) {
+			kept = append(kept, o)
+		}
+	}
+	return kept
+}
+
+// Query returns the submitted filter parameters as "&name=value" pairs to
+// append to the links of a listing, so the filter survives sorting and paging
+func (f listFilter) Query() template.URL {
+	q := url.Values{}
+	for _, p := range []struct{ name, value string }{
+		{"ext", f.Raw.Ext},
+		{"modified_after", f.Raw.After},
+		{"modified_before", f.Raw.Before},
+		{"minsize", f.Raw.MinSize},
+		{"maxsize", f.Raw.MaxSize},
+		{"deleted", f.Raw.Deleted},
+		{"summary", f.Raw.Summary},
+	} {
+		if p.value != "" {
+			q.Set(p.name, p.value)
+		}
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	// The values are URL-encoded here, so they are safe to add to an href
+	return template.URL("&" + q.Encode())
+}
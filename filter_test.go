@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	f, errs := parseFilter(url.Values{
+		"ext":             {".CSV, json"},
+		"modified_after":  {"2024-01-01"},
+		"modified_before": {"2024-02-01T00:00:00Z"},
+		"minsize":         {"1.5KB"},
+		"maxsize":         {"2 MiB"},
+	})
+	if len(errs) > 0 {
+		t.Fatalf("parseFilter errors = %v", errs)
+	}
+	if strings.Join(f.Exts, ",") != "csv,json" || f.MinSize != 1536 || f.MaxSize != 2<<20 ||
+		!f.After.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || !f.Before.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseFilter = %+v", f)
+	}
+	if got := string(f.Query()); got != "&ext=.CSV%2C+json&maxsize=2+MiB&minsize=1.5KB&modified_after=2024-01-01&modified_before=2024-02-01T00%3A00%3A00Z" {
+		t.Errorf("Query() = %q", got)
+	}
+
+	cases := []struct {
+		values url.Values
+		err    string
+	}{
+		{url.Values{"modified_after": {"yesterday"}}, "not a date"},
+		{url.Values{"minsize": {"ten"}}, "not a size"},
+		{url.Values{"maxsize": {"5PB"}}, "not a size"},
+		{url.Values{"minsize": {"2MB"}, "maxsize": {"1MB"}}, "must not be larger"},
+		{url.Values{"modified_after": {"2024-02-01"}, "modified_before": {"2024-01-01"}}, "must be earlier"},
+		{url.Values{"ext": {"a/b"}}, "not valid"},
+	}
+	for _, c := range cases {
+		f, errs := parseFilter(c.values)
+		if len(errs) != 1 || !strings.Contains(errs[0], c.err) {
+			t.Errorf("parseFilter(%v) errors = %q, want one containing %q", c.values, errs, c.err)
+		}
+		if f.Active() {
+			t.Errorf("parseFilter(%v) kept an invalid condition: %+v", c.values, f)
+		}
+	}
+}
+
+func TestListFilterMatch(t *testing.T) {
+	f, _ := parseFilter(url.Values{"ext": {"csv"}, "modified_after": {"2024-01-01"}, "modified_before": {"2024-02-01"}, "minsize": {"10"}, "maxsize": {"100"}})
+	jan := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		obj  S3Object
+		want bool
+	}{
+		{S3Object{Name: "a.CSV", Size: 50, ModTime: jan}, true},
+		{S3Object{Name: "a.json", Size: 50, ModTime: jan}, false},
+		{S3Object{Name: "a.csv", Size: 5, ModTime: jan}, false},
+		{S3Object{Name: "a.csv", Size: 500, ModTime: jan}, false},
+		{S3Object{Name: "a.csv", Size: 50, ModTime: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}, false},
+		{S3Object{Name: "a.csv", Size: 50, ModTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, true},
+		{S3Object{Name: "sub", IsDirectory: true}, true},
+	}
+	for _, c := range cases {
+		if got := f.Match(c.obj); got != c.want {
+			t.Errorf("Match(%+v) = %v, want %v", c.obj, got, c.want)
+		}
+	}
+}
+
+func TestHandlerFilters(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/a.csv":     "aaaa",
+		"data/b.json":    "b",
+		"data/c.csv":     "c",
+		"data/sub/d.csv": "d",
+	})
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	get := func(query string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/?" + query)
+		if err != nil {
+			t.Fatalf("GET %s: %v", query, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("prefix=data/&ext=csv&minsize=2")
+	if status != http.StatusOK {
+		t.Fatalf("filtered listing status = %d", status)
+	}
+	if !strings.Contains(body, "a.csv") || strings.Contains(body, "b.json") || strings.Contains(body, ">c.csv<") || !strings.Contains(body, ">sub<") {
+		t.Error("filtered listing should hold a.csv and the sub folder only")
+	}
+	if !strings.Contains(body, "sortby=size&sort=asc&limit=25&amp;ext=csv&amp;minsize=2") {
+		t.Error("sort links do not keep the filter")
+	}
+	if !strings.Contains(body, `name="ext" value="csv"`) {
+		t.Error("filter bar does not show the ext filter")
+	}
+
+	status, body = get("prefix=data/&minsize=lots")
+	if status != http.StatusBadRequest || !strings.Contains(body, "Minimum size &#34;lots&#34; is not a size") || !strings.Contains(body, `value="lots"`) {
+		t.Errorf("invalid filter = %d, message shown %v", status, strings.Contains(body, "is not a size"))
+	}
+	if !strings.Contains(body, "b.json") {
+		t.Error("listing with an invalid filter should still list the folder")
+	}
+
+	// The truncation notice gives the cap, not the filtered count
+	reg := newBucketRegistry("Test", []*Bucket{{ID: "test", Title: "Test Bucket", Store: store, MaxListItems: 2}})
+	rec := httptest.NewRecorder()
+	newHandler(reg, newTemplate()).ServeHTTP(rec, httptest.NewRequest("GET", "/?prefix=data/&ext=csv", nil))
+	if want := "Only the first 2 entries of this folder were filtered and sorted."; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("capped filtered listing does not say %q", want)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// listCacheHeader reports how the listing behind a response was served
+const listCacheHeader = "X-Listing-Cache"
+
+// Listing cache outcomes, from best to worst
+const (
+	cacheHit        = "HIT"         // fresh cached page
+	cacheStale      = "STALE"       // stale page served while it is refreshed
+	cacheStaleError = "STALE-ERROR" // stale page served because S3 failed
+	cacheMiss       = "MISS"        // fetched from S3
+)
+
+// cachePolicy says how long listing pages stay fresh and for how long
+// afterwards a stale copy may still be served
+type cachePolicy struct {
+	TTL                  time.Duration // 0 disables caching
+	StaleWhileRevalidate time.Duration // served stale while refreshed in the background
+	StaleIfError         time.Duration // served stale when S3 cannot be reached
+}
+
+// retain is how long an entry must be kept to honour the policy
+func (p cachePolicy) retain() time.Duration {
+	return p.TTL + max(p.StaleWhileRevalidate, p.StaleIfError)
+}
+
+// listingCache stores encoded listing pages. It is backed by the Fastly cache
+// on Compute and by an in-memory map in standalone mode.
+type listingCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, retain time.Duration)
+
+	// Background runs f without delaying the current response
+	Background(f func())
+}
+
+// cachedEntry is a listing page as stored in the cache
+type cachedEntry struct {
+	Fetched time.Time `json:"fetched"`
+	Page    *ListPage `json:"page"`
+}
+
+// cachedStore serves List calls from a listingCache. Other calls go straight
+// to the wrapped store.
+type cachedStore struct {
+	ObjectStore
+	cache  listingCache
+	policy cachePolicy
+	scope  string // separates the entries of different buckets
+	now    func() time.Time
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+}
+
+func newCachedStore(store ObjectStore, cache listingCache, policy cachePolicy, scope string) *cachedStore {
+	return &cachedStore{
+		ObjectStore: store,
+		cache:       cache,
+		policy:      policy,
+		scope:       scope,
+		now:         time.Now,
+		refreshing:  map[string]bool{},
+	}
+}
+
+// List implements ObjectStore
+func (c *cachedStore) List(ctx context.Context, opts ListOptions) (*ListPage, error) {
+	// Recursive walks read each page once; caching them would only push
+	// folder listings out of the cache
+	if opts.Delimiter == "" {
+		return c.ObjectStore.List(ctx, opts)
+	}
+	key := c.key(opts)
+	entry, cached := c.lookup(key)
+	if cached {
+		age := c.now().Sub(entry.Fetched)
+		switch {
+		case age < c.policy.TTL:
+			recordCacheStatus(ctx, cacheHit)
+			return entry.Page, nil
+		case age < c.policy.TTL+c.policy.StaleWhileRevalidate:
+			recordCacheStatus(ctx, cacheStale)
+			c.refreshLater(context.WithoutCancel(ctx), key, opts)
+			return entry.Page, nil
+		}
+	}
+
+	page, err := c.fetch(ctx, key, opts)
+	if err != nil {
+		if cached && c.now().Sub(entry.Fetched) < c.policy.TTL+c.policy.StaleIfError {
+			fmt.Printf("Serving stale listing after error: %v\n", err)
+			recordCacheStatus(ctx, cacheStaleError)
+			return entry.Page, nil
+		}
+		return nil, err
+	}
+	recordCacheStatus(ctx, cacheMiss)
+	return page, nil
+}
+
+// ListVersions implements versionLister when the wrapped store does. Version
+// listings are not cached: history pages are expected to be current.
+func (c *cachedStore) ListVersions(ctx context.Context, opts ListOptions) (*VersionPage, error) {
+	return listVersions(ctx, c.ObjectStore, opts)
+}
+
+func (c *cachedStore) key(opts ListOptions) string {
+	raw, _ := json.Marshal(opts)
+	sum := sha256.Sum256(raw)
+	return "list/" + c.scope + "/" + hex.EncodeToString(sum[:])
+}
+
+func (c *cachedStore) lookup(key string) (cachedEntry, bool) {
+	var entry cachedEntry
+	raw, ok := c.cache.Get(key)
+	if !ok {
+		return entry, false
+	}
+	if err := json.Unmarshal(raw, &entry); err != nil || entry.Page == nil {
+		return entry, false
+	}
+	return entry, true
+}
+
+// fetch lists from the wrapped store and caches the result
+func (c *cachedStore) fetch(ctx context.Context, key string, opts ListOptions) (*ListPage, error) {
+	page, err := c.ObjectStore.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(cachedEntry{Fetched: c.now(), Page: page})
+	if err != nil {
+		return nil, err
+	}
+	c.cache.Set(key, raw, c.policy.retain())
+	return page, nil
+}
+
+// refreshLater fetches a stale page again in the background, once per key
+func (c *cachedStore) refreshLater(ctx context.Context, key string, opts ListOptions) {
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+
+	c.cache.Background(func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+		if _, err := c.fetch(ctx, key, opts); err != nil {
+			fmt.Printf("Error refreshing listing: %v\n", err)
+		}
+	})
+}
+
+// cacheStatus collects the cache outcomes of the listing calls made for one
+// response; the worst outcome is reported
+type cacheStatus struct {
+	mu    sync.Mutex
+	value string
+}
+
+type cacheStatusKey struct{}
+
+var cacheStatusRank = map[string]int{cacheHit: 1, cacheStale: 2, cacheStaleError: 3, cacheMiss: 4}
+
+// withCacheStatus returns a context in which cachedStore records its outcomes
+func withCacheStatus(ctx context.Context) (context.Context, *cacheStatus) {
+	s := &cacheStatus{}
+	return context.WithValue(ctx, cacheStatusKey{}, s), s
+}
+
+func recordCacheStatus(ctx context.Context, value string) {
+	s, _ := ctx.Value(cacheStatusKey{}).(*cacheStatus)
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if cacheStatusRank[value] > cacheStatusRank[s.value] {
+		s.value = value
+	}
+	s.mu.Unlock()
+}
+
+// SetHeader adds the X-Listing-Cache header when a cached store was used
+func (s *cacheStatus) SetHeader(h http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value != "" {
+		h.Set(listCacheHeader, s.value)
+	}
+}
+
+// maxMemoryCacheBytes bounds the standalone cache by the approximate size of
+// its keys and encoded pages. A single listing page holds up to MaxListItems
+// objects, so counting entries alone would not bound memory.
+const maxMemoryCacheBytes = 64 << 20
+
+// memoryCache is the in-process listingCache used in standalone mode. It
+// evicts the least recently used pages once maxBytes is exceeded.
+type memoryCache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element // values are *memoryCacheEntry
+	lru      *list.List               // most recently used first
+	size     int
+	maxBytes int
+	now      func() time.Time
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func (e *memoryCacheEntry) size() int {
+	return len(e.key) + len(e.value)
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: map[string]*list.Element{}, lru: list.New(), maxBytes: maxMemoryCacheBytes, now: time.Now}
+}
+
+// Get implements listingCache
+func (m *memoryCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*memoryCacheEntry)
+	if !m.now().Before(e.expires) {
+		return nil, false
+	}
+	m.lru.MoveToFront(el)
+	return e.value, true
+}
+
+// Set implements listingCache
+func (m *memoryCache) Set(key string, value []byte, retain time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.remove(el)
+	}
+	e := &memoryCacheEntry{key: key, value: value, expires: m.now().Add(retain)}
+	if e.size() > m.maxBytes {
+		// Larger than the whole cache: not worth evicting everything for
+		return
+	}
+	m.entries[key] = m.lru.PushFront(e)
+	m.size += e.size()
+	for m.size > m.maxBytes {
+		m.remove(m.lru.Back())
+	}
+}
+
+func (m *memoryCache) remove(el *list.Element) {
+	e := m.lru.Remove(el).(*memoryCacheEntry)
+	delete(m.entries, e.key)
+	m.size -= e.size()
+}
+
+// Background implements listingCache
+func (m *memoryCache) Background(f func()) {
+	go f()
+}
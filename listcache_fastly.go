@@ -0,0 +1,69 @@
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/cache/core"
+)
+
+// fastlyCache keeps listing pages in the Fastly cache of the POP serving the
+// request. Background work is queued and run by RunBackground once the
+// response has been sent, since the instance exits when the handler returns.
+type fastlyCache struct {
+	pending []func()
+}
+
+// Get implements listingCache
+func (c *fastlyCache) Get(key string) ([]byte, bool) {
+	found, err := core.Lookup([]byte(key), core.LookupOptions{})
+	if err != nil {
+		if !errors.Is(err, core.ErrNotFound) {
+			fmt.Printf("Error reading cache: %v\n", err)
+		}
+		return nil, false
+	}
+	defer found.Body.Close()
+	value, err := io.ReadAll(found.Body)
+	if err != nil {
+		fmt.Printf("Error reading cache: %v\n", err)
+		return nil, false
+	}
+	return value, true
+}
+
+// Set implements listingCache
+func (c *fastlyCache) Set(key string, value []byte, retain time.Duration) {
+	w, err := core.Insert([]byte(key), core.WriteOptions{TTL: retain, Length: uint64(len(value))})
+	if err != nil {
+		fmt.Printf("Error writing cache: %v\n", err)
+		return
+	}
+	if _, err := io.Copy(w, bytes.NewReader(value)); err != nil {
+		fmt.Printf("Error writing cache: %v\n", err)
+		_ = w.Abandon()
+		return
+	}
+	if err := w.Close(); err != nil {
+		fmt.Printf("Error writing cache: %v\n", err)
+	}
+}
+
+// Background implements listingCache
+func (c *fastlyCache) Background(f func()) {
+	c.pending = append(c.pending, f)
+}
+
+// RunBackground runs the queued background work
+func (c *fastlyCache) RunBackground() {
+	for len(c.pending) > 0 {
+		f := c.pending[0]
+		c.pending = c.pending[1:]
+		f()
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// queuedCache is a memoryCache whose background work runs when the test asks
+type queuedCache struct {
+	*memoryCache
+	pending []func()
+}
+
+func (q *queuedCache) Background(f func()) { q.pending = append(q.pending, f) }
+
+func (q *queuedCache) run() {
+	for _, f := range q.pending {
+		f()
+	}
+	q.pending = nil
+}
+
+// failingStore lets a test make List fail
+type failingStore struct {
+	ObjectStore
+	fail  bool
+	lists int
+}
+
+func (f *failingStore) List(ctx context.Context, opts ListOptions) (*ListPage, error) {
+	f.lists++
+	if f.fail {
+		return nil, errors.New("origin down")
+	}
+	return f.ObjectStore.List(ctx, opts)
+}
+
+func TestCachedStoreStaleWhileRevalidate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	origin := &failingStore{ObjectStore: newFakeStore(map[string]string{"a.csv": "a"})}
+	cache := &queuedCache{memoryCache: newMemoryCache()}
+	cache.now = clock
+	store := newCachedStore(origin, cache, cachePolicy{TTL: time.Minute, StaleWhileRevalidate: time.Minute, StaleIfError: time.Hour}, "test")
+	store.now = clock
+
+	list := func(want string) {
+		t.Helper()
+		ctx, status := withCacheStatus(context.Background())
+		page, err := store.List(ctx, ListOptions{Delimiter: "/"})
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(page.Objects) != 1 {
+			t.Errorf("List returned %d objects, want 1", len(page.Objects))
+		}
+		h := http.Header{}
+		status.SetHeader(h)
+		if got := h.Get(listCacheHeader); got != want {
+			t.Errorf("cache status = %q, want %q", got, want)
+		}
+	}
+
+	list(cacheMiss)
+	list(cacheHit)
+	if origin.lists != 1 {
+		t.Fatalf("origin lists = %d, want 1", origin.lists)
+	}
+
+	now = now.Add(90 * time.Second)
+	list(cacheStale)
+	list(cacheStale)
+	if len(cache.pending) != 1 {
+		t.Fatalf("queued refreshes = %d, want 1", len(cache.pending))
+	}
+	cache.run()
+	list(cacheHit)
+	if origin.lists != 2 {
+		t.Errorf("origin lists after refresh = %d, want 2", origin.lists)
+	}
+
+	origin.fail = true
+	now = now.Add(10 * time.Minute)
+	list(cacheStaleError)
+
+	now = now.Add(2 * time.Hour)
+	if _, err := store.List(context.Background(), ListOptions{Delimiter: "/"}); err == nil {
+		t.Error("List succeeded after the stale-if-error window")
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	m := newMemoryCache()
+	m.maxBytes = 30 // room for two 10-byte pages and their 1-byte keys
+	page := make([]byte, 10)
+
+	m.Set("a", page, time.Hour)
+	m.Set("b", page, time.Hour)
+	if _, ok := m.Get("a"); !ok {
+		t.Fatal("a missing before the cache filled up")
+	}
+	m.Set("c", page, time.Hour)
+	if _, ok := m.Get("b"); ok {
+		t.Error("b, the least recently used page, was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := m.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if m.size != 22 || m.lru.Len() != 2 {
+		t.Errorf("size = %d bytes in %d entries, want 22 in 2", m.size, m.lru.Len())
+	}
+
+	m.Set("a", make([]byte, 20), time.Hour)
+	if _, ok := m.Get("c"); ok {
+		t.Error("c was kept after a grew past the budget")
+	}
+	if m.size != 21 {
+		t.Errorf("size = %d, want 21", m.size)
+	}
+
+	m.Set("big", make([]byte, 100), time.Hour)
+	if _, ok := m.Get("big"); ok {
+		t.Error("a page larger than the whole cache was stored")
+	}
+	if _, ok := m.Get("a"); !ok {
+		t.Error("a was evicted for a page that could never fit")
+	}
+}
+
+func TestHandlerReportsListingCache(t *testing.T) {
+	store := newCachedStore(newFakeStore(map[string]string{"a.csv": "a"}), newMemoryCache(), cachePolicy{TTL: time.Minute}, "test")
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	for _, want := range []string{cacheMiss, cacheHit} {
+		resp, err := http.Get(srv.URL + "/")
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		_ = resp.Body.Close()
+		if got := resp.Header.Get(listCacheHeader); got != want {
+			t.Errorf("%s = %q, want %q", listCacheHeader, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Listing formats selected by the Accept header
+const (
+	formatHTML = "text/html"
+	formatJSON = "application/json"
+	formatText = "text/plain"
+	formatCSV  = "text/csv"
+)
+
+// listTruncatedHeader marks a text or CSV listing that stopped at the
+// bucket's MaxListItems entries
+const listTruncatedHeader = "X-Listing-Truncated"
+
+// listingFormats are the formats a listing can be rendered in, in order of
+// preference when the client accepts several equally
+var listingFormats = []string{formatHTML, formatJSON, formatText, formatCSV}
+
+// negotiateFormat picks the listing format for an Accept header. A missing
+// header, or one matching none of the formats, gets HTML.
+func negotiateFormat(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return formatHTML
+	}
+	best, bestQ, bestSpecificity := formatHTML, 0.0, -1
+	for _, format := range listingFormats {
+		q, specificity := acceptQuality(accept, format)
+		if q > bestQ || (q == bestQ && q > 0 && specificity > bestSpecificity) {
+			best, bestQ, bestSpecificity = format, q, specificity
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q-value an Accept header gives to mediaType,
+// taken from its most specific matching range, and how specific that range
+// is (0 for */*, 1 for type/*, 2 for an exact match)
+func acceptQuality(accept, mediaType string) (q float64, specificity int) {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	specificity = -1
+	for _, part := range strings.Split(accept, ",") {
+		rng, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		s := -1
+		switch {
+		case rng == mediaType:
+			s = 2
+		case rng == typ+"/*":
+			s = 1
+		case rng == "*/*":
+			s = 0
+		}
+		if s < specificity || s < 0 {
+			continue
+		}
+		rangeQ := 1.0
+		if v, ok := params["q"]; ok {
+			if rangeQ, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if s > specificity {
+			q, specificity = rangeQ, s
+		} else if rangeQ > q {
+			q = rangeQ
+		}
+	}
+	return q, specificity
+}
+
+// writeListingText writes one key per line; folders end in a slash
+func writeListingText(w http.ResponseWriter, l *listing) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	var b strings.Builder
+	for _, o := range l.Items {
+		b.WriteString(o.Key)
+		b.WriteByte('\n')
+	}
+	if _, err := fmt.Fprint(w, b.String()); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// writeListingCSV writes the listing as CSV with a header row
+func writeListingCSV(w http.ResponseWriter, l *listing) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	records := [][]string{{"key", "name", "is_directory", "size", "last_modified", "type", "url"}}
+	for _, o := range l.Items {
+		modified := ""
+		if !o.IsDirectory {
+			modified = o.ModTime.UTC().Format(time.RFC3339)
+		}
+		records = append(records, []string{
+			o.Key,
+			o.Name,
+			strconv.FormatBool(o.IsDirectory),
+			strconv.FormatInt(o.Size, 10),
+			modified,
+			o.Type,
+			o.S3URL,
+		})
+	}
+	if err := cw.WriteAll(records); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", formatHTML},
+		{"*/*", formatHTML},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", formatHTML},
+		{"application/json", formatJSON},
+		{"application/json, text/html;q=0.5", formatJSON},
+		{"text/plain", formatText},
+		{"text/*;q=0.5, text/csv", formatCSV},
+		{"text/csv;q=0.2, text/plain;q=0.4", formatText},
+		{"image/png", formatHTML},
+	}
+	for _, c := range cases {
+		if got := negotiateFormat(c.accept); got != c.want {
+			t.Errorf("negotiateFormat(%q) = %q, want %q", c.accept, got, c.want)
+		}
+	}
+}
+
+func TestListingContentNegotiation(t *testing.T) {
+	store := newFakeStore(map[string]string{"data/a,b.csv": "a", "data/sub/c.csv": "c"})
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	cases := []struct {
+		accept, contentType string
+		want                []string
+	}{
+		{"text/html", "text/html; charset=utf-8", []string{"<!DOCTYPE html>"}},
+		{"application/json", "application/json; charset=utf-8", []string{`"key": "data/a,b.csv"`, `"version": 1`}},
+		{"text/plain", "text/plain; charset=utf-8", []string{"data/a,b.csv\ndata/sub/\n"}},
+		{"text/csv", "text/csv; charset=utf-8", []string{"key,name,is_directory,size,last_modified,type,url\n", `"data/a,b.csv","a,b.csv",false,1,2024-01-02T03:04:05Z,csv,`}},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", srv.URL+"/?prefix=data/", nil)
+		req.Header.Set("Accept", c.accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET with Accept %q: %v", c.accept, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != c.contentType {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", c.accept, ct, c.contentType)
+		}
+		if v := resp.Header.Get("Vary"); v != "Accept" {
+			t.Errorf("Accept %q: Vary = %q, want Accept", c.accept, v)
+		}
+		for _, want := range c.want {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("Accept %q: body does not contain %q:\n%s", c.accept, want, body)
+			}
+		}
+	}
+}
+
+func TestTextListingIsWhole(t *testing.T) {
+	objects := map[string]string{}
+	for i := range 60 {
+		objects[fmt.Sprintf("data/%02d.csv", i)] = "x"
+	}
+	b := &Bucket{ID: "test", Title: "Test Bucket", Store: newFakeStore(objects)}
+	handler := newHandler(newBucketRegistry("Test", []*Bucket{b}), newTemplate())
+
+	for _, c := range []struct {
+		maxListItems, lines int
+		truncated           string
+	}{
+		{maxListItems: 0, lines: 60},
+		{maxListItems: 50, lines: 50, truncated: "true"},
+	} {
+		b.MaxListItems = c.maxListItems
+		for _, accept := range []string{"text/plain", "text/csv"} {
+			req := httptest.NewRequest("GET", "/?prefix=data/&limit=25", nil)
+			req.Header.Set("Accept", accept)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			lines := strings.Count(rec.Body.String(), "\n")
+			if accept == "text/csv" {
+				lines-- // header row
+			}
+			if lines != c.lines || rec.Header().Get(listTruncatedHeader) != c.truncated {
+				t.Errorf("%s with max_list_items %d: %d lines, %s %q", accept, c.maxListItems, lines, listTruncatedHeader, rec.Header().Get(listTruncatedHeader))
+			}
+		}
+	}
+}
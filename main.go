@@ -2,16 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
-
-	"github.com/fastly/compute-sdk-go/fsthttp"
+	"time"
 )
 
 // S3Object represents a file or directory in the S3 bucket
@@ -24,6 +25,23 @@ type S3Object struct {
 	Href         string
 	Type         string // file extension/type
 	S3URL        string // direct S3 URL
+	ModTime      time.Time
+	Deleted      bool           // latest version is a delete marker
+	Summary      *folderSummary // set for folders once summarized
+}
+
+// tableRow is the data of one row of the file table
+type tableRow struct {
+	S3Object
+	BasePath, SortBy, SortOrder string
+	Limit                       int
+	ShowFolder                  bool   // show the containing folder, for search hits
+	Folder                      string // containing folder prefix
+}
+
+// newTableRow is the "row" template function used by the browser table
+func newTableRow(basePath, sortBy, sortOrder string, limit int, o S3Object) tableRow {
+	return tableRow{S3Object: o, BasePath: basePath, SortBy: sortBy, SortOrder: sortOrder, Limit: limit}
 }
 
 // Breadcrumb represents a navigation path element
@@ -38,6 +56,9 @@ type PageData struct {
 	Breadcrumbs  []Breadcrumb
 	CurrentPath  string
 	ParentPrefix string
+	Title        string
+	BasePath     string // path the bucket is served under, e.g. "/" or "/b/<id>/"
+	HomeURL      string // landing page link, empty for single-bucket deployments
 }
 
 const (
@@ -46,78 +67,11 @@ const (
 <head>
     <meta charset="utf-8">
     <meta name="viewport" content="width=device-width, initial-scale=1">
-    <title>Geonet Open Data Browser</title>
-    <style>
-        :root {
-            --bg: #f6f8fa;
-            --fg: #222;
-            --card: #fff;
-            --border: #e1e4e8;
-            --primary: #2d7ff9;
-            --hover: #f0f4fa;
-            --icon: #6a737d;
-            --accent: #eaf5ff;
-        }
-        [data-theme="dark"] {
-            --bg: #181a1b;
-            --fg: #eaeaea;
-            --card: #23272e;
-            --border: #30363d;
-            --primary: #58a6ff;
-            --hover: #23272e;
-            --icon: #8b949e;
-            --accent: #1a2a3a;
-        }
-        html, body { background: var(--bg); color: var(--fg); margin: 0; padding: 0; }
-        body { font-family: 'Segoe UI', 'Roboto', Arial, sans-serif; min-height: 100vh; }
-        .container { max-width: 900px; margin: 2rem auto; background: var(--card); border-radius: 12px; box-shadow: 0 2px 8px rgba(0,0,0,0.04); padding: 2rem 2.5vw; border: 1px solid var(--border); }
-        h1 { font-size: 1.7rem; margin-bottom: 1.2rem; letter-spacing: -1px; }
-        .breadcrumb { margin-bottom: 18px; font-size: 1.05em; }
-        .breadcrumb a { color: var(--primary); text-decoration: none; }
-        .breadcrumb a:hover { text-decoration: underline; }
-        .breadcrumb .current { font-weight: bold; color: var(--fg); }
-        .theme-toggle { float: right; margin-top: -2.5rem; margin-bottom: 1rem; }
-        .theme-toggle button { background: var(--accent); color: var(--primary); border: none; border-radius: 6px; padding: 0.4em 1em; font-size: 1em; cursor: pointer; transition: background 0.2s; }
-        .theme-toggle button:hover { background: var(--primary); color: #fff; }
-        .controls { display: flex; align-items: center; gap: 2em; margin-bottom: 1em; }
-        .sort-toggle, .limit-toggle { font-size: 1em; }
-        .sort-toggle a, .limit-toggle a { color: var(--primary); text-decoration: none; margin-right: 0.5em; }
-        .sort-toggle a.active, .limit-toggle a.active { font-weight: bold; text-decoration: underline; }
-        .pagination { margin: 1.5em 0 1em 0; text-align: center; }
-        .pagination a { color: var(--primary); text-decoration: none; margin: 0 0.3em; padding: 0.2em 0.7em; border-radius: 5px; }
-        .pagination a.active { background: var(--primary); color: #fff; font-weight: bold; }
-        .pagination a:hover { background: var(--accent); }
-        table { width: 100%; border-collapse: separate; border-spacing: 0; background: var(--card); border-radius: 10px; overflow: hidden; }
-        th, td { padding: 12px 10px; text-align: left; border-bottom: 1px solid var(--border); }
-        th { background: var(--bg); font-weight: 600; }
-        tr:last-child td { border-bottom: none; }
-        tr:hover { background: var(--hover); }
-        .folder, .file { font-weight: 500; }
-        .icon { color: var(--icon); margin-right: 0.5em; font-size: 1.2em; vertical-align: middle; }
-        .download-btn, .copy-btn { background: none; border: none; cursor: pointer; color: var(--icon); font-size: 1.1em; margin-left: 0.5em; }
-        .download-btn:hover, .copy-btn:hover { color: var(--primary); }
-        @media (max-width: 700px) {
-            .container { padding: 0.5rem; }
-            table, thead, tbody, th, td, tr { display: block; width: 100%; }
-            th, td { box-sizing: border-box; width: 100%; }
-            tr { margin-bottom: 1em; }
-        }
-        a { color: var(--primary); text-decoration: none; }
-        a:hover { text-decoration: underline; }
-        a:visited { color: var(--primary); }
-        [data-theme="dark"] a { color: #58a6ff; }
-        [data-theme="dark"] a:visited { color: #a5d6ff; }
-    </style>
+    <title>{{.Title}}</title>
+    <link rel="alternate" type="application/atom+xml" title="Recently modified in /{{.Prefix}}" href="{{.BasePath}}_/feed.atom?prefix={{.Prefix}}">
+    {{template "style"}}
+    {{template "theme"}}
     <script>
-    // Dark mode toggle logic
-    function setTheme(theme) {
-        document.documentElement.setAttribute('data-theme', theme);
-        localStorage.setItem('theme', theme);
-    }
-    function toggleTheme() {
-        const current = document.documentElement.getAttribute('data-theme');
-        setTheme(current === 'dark' ? 'light' : 'dark');
-    }
     (function() {
         // Sort order memory
         var url = new URL(window.location.href);
@@ -131,15 +85,6 @@ const (
         } else {
             localStorage.setItem('sortOrder', sort);
         }
-        // Theme memory
-        const saved = localStorage.getItem('theme');
-        if (saved) {
-            setTheme(saved);
-        } else if (window.matchMedia('(prefers-color-scheme: dark)').matches) {
-            setTheme('dark');
-        } else {
-            setTheme('light');
-        }
     })();
     function copyToClipboard(text) {
         navigator.clipboard.writeText(text).then(function() {
@@ -148,6 +93,35 @@ const (
             alert('Failed to copy.');
         });
     }
+    function formatSize(size) {
+        var units = ['B', 'KB', 'MB', 'GB'];
+        var i = 0;
+        while (size >= 1024 && i < units.length - 1) {
+            size /= 1024;
+            i++;
+        }
+        return i === 0 ? size + ' B' : size.toFixed(2) + ' ' + units[i];
+    }
+    function loadSummary(btn, basePath, prefix) {
+        btn.disabled = true;
+        btn.textContent = '…';
+        fetch(basePath + '_/api/summary?prefix=' + encodeURIComponent(prefix)).then(function(resp) {
+            return resp.json();
+        }).then(function(s) {
+            if (s.error) {
+                throw new Error(s.error);
+            }
+            var row = btn.closest('tr');
+            row.querySelector('td.date').textContent = s.last_modified ? s.last_modified.replace('T', ' ').replace('Z', '') : '';
+            var cell = btn.parentNode;
+            cell.title = s.count + ' files';
+            cell.textContent = (s.truncated ? '≥ ' : '') + formatSize(s.size);
+        }).catch(function(err) {
+            btn.disabled = false;
+            btn.textContent = 'Σ';
+            btn.title = 'Failed: ' + err.message;
+        });
+    }
     </script>
 </head>
 <body>
@@ -155,48 +129,93 @@ const (
         <div class="theme-toggle">
             <button onclick="toggleTheme()" aria-label="Toggle dark mode">🌓 Theme</button>
         </div>
-        <h1>Geonet Open Data Browser</h1>
+        <h1>{{.Title}}</h1>
         <div class="breadcrumb" aria-label="Breadcrumb">
-            <a href="/?prefix=&page=1&sort={{.SortOrder}}&limit={{.Limit}}">Home</a>
+            {{if .HomeURL}}<a href="{{.HomeURL}}">Home</a> /{{end}}
             {{range $i, $b := .Breadcrumbs}}
-                / {{if eq (add $i 1) (len $.Breadcrumbs)}}<span class="current">{{$b.Name}}</span>{{else}}<a href="{{$b.Path}}">{{$b.Name}}</a>{{end}}
+                {{if $i}}/ {{end}}{{if eq (add $i 1) (len $.Breadcrumbs)}}<span class="current">{{$b.Name}}</span>{{else}}<a href="{{$b.Path}}">{{$b.Name}}</a>{{end}}
             {{end}}
         </div>
+        {{template "search_form" (searchForm .BasePath .Prefix)}}
+        <form class="filters" method="get" aria-label="Filter files">
+            <input type="hidden" name="prefix" value="{{.Prefix}}">
+            <input type="hidden" name="sortby" value="{{.SortBy}}">
+            <input type="hidden" name="sort" value="{{.SortOrder}}">
+            <input type="hidden" name="limit" value="{{.Limit}}">
+            <label>Type <input name="ext" value="{{.Filter.Ext}}" placeholder="csv,json" size="10"></label>
+            <label>Modified from <input type="date" name="modified_after" value="{{.Filter.After}}"></label>
+            <label>to <input type="date" name="modified_before" value="{{.Filter.Before}}"></label>
+            <label>Size <input name="minsize" value="{{.Filter.MinSize}}" placeholder="min" size="6"></label>
+            <label>– <input name="maxsize" value="{{.Filter.MaxSize}}" placeholder="max, e.g. 10MB" size="10"></label>
+            <label><input type="checkbox" name="deleted" value="1"{{if .Filter.Deleted}} checked{{end}}> Show deleted</label>
+            <label><input type="checkbox" name="summary" value="1"{{if .Filter.Summary}} checked{{end}}> Folder sizes</label>
+            <button type="submit">Filter</button>
+            {{if or .FilterActive .FilterErrors}}<a href="?prefix={{.Prefix}}&page=1&sortby={{.SortBy}}&sort={{.SortOrder}}&limit={{.Limit}}">Clear</a>{{end}}
+        </form>
+        {{range .FilterErrors}}<p class="notice error" role="alert">{{.}}</p>{{end}}
         {{if .ParentPrefix}}
         <p><a href="?prefix={{.ParentPrefix}}&page=1&sort={{.SortOrder}}&limit={{.Limit}}" aria-label="Parent folder">⬅️ Parent folder</a></p>
         {{end}}
         <div class="controls">
             <span class="sort-toggle">
-                <a href="?prefix={{.Prefix}}&page=1&sort={{if eq .SortOrder "asc"}}desc{{else}}asc{{end}}&limit={{.Limit}}">
+                <a href="?prefix={{.Prefix}}&page=1&sort={{if eq .SortOrder "asc"}}desc{{else}}asc{{end}}&limit={{.Limit}}{{$.FilterQuery}}">
                     Sort: {{if eq .SortOrder "asc"}}⬆️{{else}}⬇️{{end}}
                 </a>
             </span>
             <span class="limit-toggle">
                 Show:
                 {{range $v := (slice 25 50 75 100)}}
-                    <a href="?prefix={{$.Prefix}}&page=1&sort={{$.SortOrder}}&limit={{$v}}"{{if eq $.Limit $v}} class="active"{{end}}>{{$v}}</a>
+                    <a href="?prefix={{$.Prefix}}&page=1&sort={{$.SortOrder}}&limit={{$v}}{{$.FilterQuery}}"{{if eq $.Limit $v}} class="active"{{end}}>{{$v}}</a>
                 {{end}}
             </span>
+            <details class="export-menu">
+                <summary>📦 Export</summary>
+                <ul>
+                    <li><a href="{{.BasePath}}_/zip?prefix={{.Prefix}}">ZIP archive</a></li>
+                    <li><a href="{{.BasePath}}_/tar.gz?prefix={{.Prefix}}">tar.gz archive</a></li>
+                    <li><a href="{{.BasePath}}_/tar?prefix={{.Prefix}}">tar archive</a></li>
+                    <li><a href="{{.BasePath}}_/export.meta4?prefix={{.Prefix}}">Metalink (aria2)</a></li>
+                    <li><a href="{{.BasePath}}_/export.txt?prefix={{.Prefix}}">URL list (wget -i)</a></li>
+                    <li><a href="{{.BasePath}}_/manifest?prefix={{.Prefix}}">MD5 manifest</a></li>
+                    <li><a href="{{.BasePath}}_/manifest?prefix={{.Prefix}}&algo=sha256">SHA-256 manifest</a></li>
+                </ul>
+            </details>
         </div>
         {{if gt .TotalPages 1}}
         <div class="pagination" aria-label="Pagination">
             {{if gt .Page 1}}
-                <a href="?prefix={{.Prefix}}&page={{dec .Page}}&sort={{$.SortOrder}}&limit={{$.Limit}}">⬅️ Prev</a>
+                <a href="?prefix={{.Prefix}}&page={{dec .Page}}&sort={{$.SortOrder}}&limit={{$.Limit}}{{$.FilterQuery}}">⬅️ Prev</a>
             {{end}}
             {{range $i := until .TotalPages}}
-                <a href="?prefix={{$.Prefix}}&page={{add $i 1}}&sort={{$.SortOrder}}&limit={{$.Limit}}"{{if eq $.Page (add $i 1)}} class="active"{{end}}>{{add $i 1}}</a>
+                <a href="?prefix={{$.Prefix}}&page={{add $i 1}}&sort={{$.SortOrder}}&limit={{$.Limit}}{{$.FilterQuery}}"{{if eq $.Page (add $i 1)}} class="active"{{end}}>{{add $i 1}}</a>
             {{end}}
             {{if lt .Page .TotalPages}}
-                <a href="?prefix={{.Prefix}}&page={{inc .Page}}&sort={{$.SortOrder}}&limit={{$.Limit}}">Next ➡️</a>
+                <a href="?prefix={{.Prefix}}&page={{inc .Page}}&sort={{$.SortOrder}}&limit={{$.Limit}}{{$.FilterQuery}}">Next ➡️</a>
             {{end}}
         </div>
         {{end}}
+        {{if or .HasPrev .HasNext}}
+        <div class="pagination" aria-label="Pagination">
+            {{if .HasPrev}}
+                <a href="?prefix={{.Prefix}}&cursor={{.PrevCursor}}&sortby=name&sort=asc&limit={{.Limit}}{{$.FilterQuery}}">⬅️ Prev</a>
+            {{end}}
+            {{if .HasNext}}
+                <a href="?prefix={{.Prefix}}&cursor={{.NextCursor}}&sortby=name&sort=asc&limit={{.Limit}}{{$.FilterQuery}}">Next ➡️</a>
+            {{end}}
+        </div>
+        {{end}}
+        {{if .Truncated}}
+        <p class="notice">Only the first {{.MaxListItems}} entries of this folder were {{if .FilterActive}}filtered and {{end}}sorted.{{if not .FilterActive}} Sort by name ascending to page through everything.{{end}}</p>
+        {{end}}
+        {{if .SummarySortPartial}}
+        <p class="notice">This folder has too many sub-folders to sort them by {{.SortBy}}; folders are listed by name, and only those on this page are summarized.</p>
+        {{end}}
         <table aria-label="File and folder list">
             <thead>
                 <tr>
-                    <th><a href="?prefix={{.Prefix}}&page=1&sortby=name&sort={{if and (eq .SortBy "name") (eq .SortOrder "asc")}}desc{{else}}asc{{end}}&limit={{.Limit}}">Name{{if eq .SortBy "name"}} {{if eq .SortOrder "asc"}}⬆️{{else}}⬇️{{end}}{{end}}</a></th>
-                    <th class="date"><a href="?prefix={{.Prefix}}&page=1&sortby=date&sort={{if and (eq .SortBy "date") (eq .SortOrder "asc")}}desc{{else}}asc{{end}}&limit={{.Limit}}">Last Modified{{if eq .SortBy "date"}} {{if eq .SortOrder "asc"}}⬆️{{else}}⬇️{{end}}{{end}}</a></th>
-                    <th class="size"><a href="?prefix={{.Prefix}}&page=1&sortby=size&sort={{if and (eq .SortBy "size") (eq .SortOrder "asc")}}desc{{else}}asc{{end}}&limit={{.Limit}}">Size{{if eq .SortBy "size"}} {{if eq .SortOrder "asc"}}⬆️{{else}}⬇️{{end}}{{end}}</a></th>
+                    <th><a href="?prefix={{.Prefix}}&page=1&sortby=name&sort={{if and (eq .SortBy "name") (eq .SortOrder "asc")}}desc{{else}}asc{{end}}&limit={{.Limit}}{{$.FilterQuery}}">Name{{if eq .SortBy "name"}} {{if eq .SortOrder "asc"}}⬆️{{else}}⬇️{{end}}{{end}}</a></th>
+                    <th class="date"><a href="?prefix={{.Prefix}}&page=1&sortby=date&sort={{if and (eq .SortBy "date") (eq .SortOrder "asc")}}desc{{else}}asc{{end}}&limit={{.Limit}}{{$.FilterQuery}}">Last Modified{{if eq .SortBy "date"}} {{if eq .SortOrder "asc"}}⬆️{{else}}⬇️{{end}}{{end}}</a></th>
+                    <th class="size"><a href="?prefix={{.Prefix}}&page=1&sortby=size&sort={{if and (eq .SortBy "size") (eq .SortOrder "asc")}}desc{{else}}asc{{end}}&limit={{.Limit}}{{$.FilterQuery}}">Size{{if eq .SortBy "size"}} {{if eq .SortOrder "asc"}}⬆️{{else}}⬇️{{end}}{{end}}</a></th>
                     <th>Actions</th>
                 </tr>
             </thead>
@@ -206,30 +225,157 @@ const (
                     <td colspan="4" style="text-align:center; color:#888;">This folder is empty.</td>
                 </tr>
                 {{end}}
-                {{range .Objects}}
+                {{range .Objects}}{{template "row" (row $.BasePath $.SortBy $.SortOrder $.Limit .)}}{{end}}
+            </tbody>
+        </table>
+    </div>
+</body>
+</html>
+{{define "row"}}
                 <tr>
                     <td>
-                        {{if .IsDirectory}}
-                        <span class="icon" aria-label="Folder">📁</span> <a href="?prefix={{.Key}}&page=1&sortby={{$.SortBy}}&sort={{$.SortOrder}}&limit={{$.Limit}}" class="folder">{{.Name}}</a>
+                        {{if .Deleted}}
+                        <span class="icon" aria-label="Deleted file">🗑️</span> <a href="{{.BasePath}}_/history/{{.Key}}" class="file deleted"><del>{{.Name}}</del></a>
+                        {{else if .IsDirectory}}
+                        <span class="icon" aria-label="Folder">📁</span> <a href="{{.BasePath}}?prefix={{.Key}}&page=1&sortby={{.SortBy}}&sort={{.SortOrder}}&limit={{.Limit}}" class="folder">{{.Name}}</a>
                         {{else}}
-                        <span class="icon" aria-label="File">{{if eq .Type "pdf"}}📄{{else if eq .Type "jpg"}}🖼️{{else if eq .Type "jpeg"}}🖼️{{else if eq .Type "png"}}🖼️{{else if eq .Type "txt"}}📄{{else if eq .Type "csv"}}📑{{else if eq .Type "zip"}}🗜️{{else if eq .Type "json"}}📝{{else}}📄{{end}}</span> <a href="/{{.Key}}" class="file">{{.Name}}</a>
+                        <span class="icon" aria-label="File">{{if eq .Type "pdf"}}📄{{else if eq .Type "jpg"}}🖼️{{else if eq .Type "jpeg"}}🖼️{{else if eq .Type "png"}}🖼️{{else if eq .Type "txt"}}📄{{else if eq .Type "csv"}}📑{{else if eq .Type "zip"}}🗜️{{else if eq .Type "json"}}📝{{else}}📄{{end}}</span> <a href="{{.BasePath}}{{.Key}}" class="file">{{.Name}}</a>
                         {{end}}
+                        {{if .ShowFolder}}<div class="folder-path">in <a href="{{.BasePath}}?prefix={{.Folder}}&page=1&limit={{.Limit}}">/{{.Folder}}</a></div>{{end}}
                     </td>
                     <td class="date">{{.LastModified}}</td>
-                    <td class="size">{{if .IsDirectory}}-{{else}}{{formatSize .Size}}{{end}}</td>
+                    {{if .Deleted}}<td class="size">-</td>
+                    {{else if .Summary}}<td class="size" title="{{.Summary.Count}} files">{{if .Summary.Truncated}}≥ {{end}}{{formatSize .Size}}</td>
+                    {{else if .IsDirectory}}<td class="size"><button class="copy-btn" aria-label="Calculate folder size" title="Calculate folder size" onclick="loadSummary(this, '{{.BasePath}}', '{{.Key}}')">Σ</button></td>
+                    {{else}}<td class="size">{{formatSize .Size}}</td>{{end}}
                     <td>
-                        {{if not .IsDirectory}}
-                        <a href="/{{.Key}}" download class="download-btn" aria-label="Download">⬇️</a>
+                        {{if .Deleted}}
+                        <a href="{{.BasePath}}_/history/{{.Key}}" class="download-btn" aria-label="History">🕘</a>
+                        {{else if not .IsDirectory}}
+                        <a href="{{.BasePath}}_/meta/{{.Key}}" class="download-btn" aria-label="Details">ℹ️</a>
+                        <a href="{{.BasePath}}{{.Key}}" download class="download-btn" aria-label="Download">⬇️</a>
                         <button class="copy-btn" aria-label="Copy S3 URL" onclick="copyToClipboard('{{.S3URL}}')">🔗</button>
                         {{end}}
                     </td>
                 </tr>
-                {{end}}
-            </tbody>
-        </table>
-    </div>
-</body>
-</html>`
+{{end}}
+{{define "search_form"}}
+        <form class="search" action="{{.BasePath}}_/search" method="get" role="search">
+            <input type="hidden" name="prefix" value="{{.Prefix}}">
+            <input type="search" name="q" value="{{.Query}}" placeholder="Search {{if .Prefix}}{{.Prefix}}{{else}}all files{{end}}" aria-label="Search query">
+            <select name="mode" aria-label="Match mode">
+                <option value=""{{if eq .Mode ""}} selected{{end}}>Text or glob</option>
+                <option value="substring"{{if eq .Mode "substring"}} selected{{end}}>Text</option>
+                <option value="glob"{{if eq .Mode "glob"}} selected{{end}}>Glob (*.mseed)</option>
+                <option value="regex"{{if eq .Mode "regex"}} selected{{end}}>Regular expression</option>
+            </select>
+            <button type="submit">Search</button>
+        </form>
+{{end}}
+{{define "style"}}<style>
+        :root {
+            --bg: #f6f8fa;
+            --fg: #222;
+            --card: #fff;
+            --border: #e1e4e8;
+            --primary: #2d7ff9;
+            --hover: #f0f4fa;
+            --icon: #6a737d;
+            --accent: #eaf5ff;
+        }
+        [data-theme="dark"] {
+            --bg: #181a1b;
+            --fg: #eaeaea;
+            --card: #23272e;
+            --border: #30363d;
+            --primary: #58a6ff;
+            --hover: #23272e;
+            --icon: #8b949e;
+            --accent: #1a2a3a;
+        }
+        html, body { background: var(--bg); color: var(--fg); margin: 0; padding: 0; }
+        body { font-family: 'Segoe UI', 'Roboto', Arial, sans-serif; min-height: 100vh; }
+        .container { max-width: 900px; margin: 2rem auto; background: var(--card); border-radius: 12px; box-shadow: 0 2px 8px rgba(0,0,0,0.04); padding: 2rem 2.5vw; border: 1px solid var(--border); }
+        h1 { font-size: 1.7rem; margin-bottom: 1.2rem; letter-spacing: -1px; }
+        .breadcrumb { margin-bottom: 18px; font-size: 1.05em; }
+        .breadcrumb a { color: var(--primary); text-decoration: none; }
+        .breadcrumb a:hover { text-decoration: underline; }
+        .breadcrumb .current { font-weight: bold; color: var(--fg); }
+        .theme-toggle { float: right; margin-top: -2.5rem; margin-bottom: 1rem; }
+        .theme-toggle button { background: var(--accent); color: var(--primary); border: none; border-radius: 6px; padding: 0.4em 1em; font-size: 1em; cursor: pointer; transition: background 0.2s; }
+        .theme-toggle button:hover { background: var(--primary); color: #fff; }
+        .controls { display: flex; align-items: center; gap: 2em; margin-bottom: 1em; }
+        .sort-toggle, .limit-toggle { font-size: 1em; }
+        .sort-toggle a, .limit-toggle a { color: var(--primary); text-decoration: none; margin-right: 0.5em; }
+        .sort-toggle a.active, .limit-toggle a.active { font-weight: bold; text-decoration: underline; }
+        .export-menu { margin-left: auto; position: relative; }
+        .export-menu summary { color: var(--primary); cursor: pointer; list-style: none; }
+        .export-menu ul { position: absolute; right: 0; z-index: 1; margin: 0.3em 0 0; padding: 0.4em 0; list-style: none; background: var(--bg); border: 1px solid var(--border); border-radius: 6px; white-space: nowrap; }
+        .export-menu li a { display: block; padding: 0.3em 1em; color: var(--primary); text-decoration: none; }
+        .export-menu li a:hover { background: var(--accent); }
+        .pagination { margin: 1.5em 0 1em 0; text-align: center; }
+        .pagination a { color: var(--primary); text-decoration: none; margin: 0 0.3em; padding: 0.2em 0.7em; border-radius: 5px; }
+        .pagination a.active { background: var(--primary); color: #fff; font-weight: bold; }
+        .pagination a:hover { background: var(--accent); }
+        .notice { color: var(--icon); font-size: 0.95em; }
+        .search { display: flex; gap: 0.5em; margin-bottom: 1em; }
+        .search input[type="search"] { flex: 1; padding: 0.4em 0.6em; border: 1px solid var(--border); border-radius: 6px; background: var(--card); color: var(--fg); }
+        .search select, .search button { padding: 0.4em 0.6em; border: 1px solid var(--border); border-radius: 6px; background: var(--accent); color: var(--fg); }
+        .filters { display: flex; flex-wrap: wrap; gap: 0.5em 1em; align-items: center; margin-bottom: 1em; font-size: 0.95em; }
+        .filters input { padding: 0.3em 0.5em; border: 1px solid var(--border); border-radius: 6px; background: var(--card); color: var(--fg); }
+        .filters button { padding: 0.3em 0.8em; border: 1px solid var(--border); border-radius: 6px; background: var(--accent); color: var(--fg); }
+        .filters a { color: var(--primary); }
+        .notice.error { color: #d73a49; }
+        table.meta th { width: 12em; text-align: left; }
+        table.meta code { word-break: break-all; }
+        .meta-actions { margin: 1em 0; }
+        .meta-actions .download-btn, .meta-actions .copy-btn { margin: 0 1em 0 0; font-size: 1em; }
+        .muted { color: var(--icon); }
+        .folder-path { font-size: 0.85em; color: var(--icon); margin-left: 1.8em; }
+        .folder-path a { color: var(--icon); }
+        table { width: 100%; border-collapse: separate; border-spacing: 0; background: var(--card); border-radius: 10px; overflow: hidden; }
+        th, td { padding: 12px 10px; text-align: left; border-bottom: 1px solid var(--border); }
+        th { background: var(--bg); font-weight: 600; }
+        tr:last-child td { border-bottom: none; }
+        tr:hover { background: var(--hover); }
+        .folder, .file { font-weight: 500; }
+        .icon { color: var(--icon); margin-right: 0.5em; font-size: 1.2em; vertical-align: middle; }
+        .download-btn, .copy-btn { background: none; border: none; cursor: pointer; color: var(--icon); font-size: 1.1em; margin-left: 0.5em; }
+        .download-btn:hover, .copy-btn:hover { color: var(--primary); }
+        @media (max-width: 700px) {
+            .container { padding: 0.5rem; }
+            table, thead, tbody, th, td, tr { display: block; width: 100%; }
+            th, td { box-sizing: border-box; width: 100%; }
+            tr { margin-bottom: 1em; }
+        }
+        a { color: var(--primary); text-decoration: none; }
+        a:hover { text-decoration: underline; }
+        a:visited { color: var(--primary); }
+        [data-theme="dark"] a { color: #58a6ff; }
+        [data-theme="dark"] a:visited { color: #a5d6ff; }
+    </style>{{end}}
+{{define "theme"}}<script>
+    // Dark mode toggle logic
+    function setTheme(theme) {
+        document.documentElement.setAttribute('data-theme', theme);
+        localStorage.setItem('theme', theme);
+    }
+    function toggleTheme() {
+        const current = document.documentElement.getAttribute('data-theme');
+        setTheme(current === 'dark' ? 'light' : 'dark');
+    }
+    (function() {
+        // Theme memory
+        const saved = localStorage.getItem('theme');
+        if (saved) {
+            setTheme(saved);
+        } else if (window.matchMedia('(prefers-color-scheme: dark)').matches) {
+            setTheme('dark');
+        } else {
+            setTheme('light');
+        }
+    })();
+    </script>{{end}}`
 	sortOrderAsc  = "asc"
 	sortOrderDesc = "desc"
 )
@@ -242,19 +388,10 @@ const (
 // synthetic responses.
 
 // handleFileRequest handles requests for individual files
-func handleFileRequest(ctx context.Context, w fsthttp.ResponseWriter, fileKey string) error {
-	s3URL := fmt.Sprintf("https://geonet-open-data.s3-ap-southeast-2.amazonaws.com/%s", fileKey)
-	req, err := fsthttp.NewRequest("GET", s3URL, nil)
-	if err != nil {
-		w.WriteHeader(fsthttp.StatusInternalServerError)
-		if _, err := fmt.Fprintf(w, "Error creating S3 request: %v\n", err); err != nil {
-			fmt.Printf("Error writing response: %v\n", err)
-		}
-		return err
-	}
-	resp, err := req.Send(ctx, "TheOrigin")
+func handleFileRequest(ctx context.Context, w http.ResponseWriter, store ObjectStore, fileKey string, opts GetOptions) error {
+	resp, err := store.Get(ctx, fileKey, opts)
 	if err != nil {
-		w.WriteHeader(fsthttp.StatusBadGateway)
+		w.WriteHeader(http.StatusBadGateway)
 		if _, err := fmt.Fprintf(w, "Error fetching from S3: %v\n", err); err != nil {
 			fmt.Printf("Error writing response: %v\n", err)
 		}
@@ -280,12 +417,20 @@ func handleFileRequest(ctx context.Context, w fsthttp.ResponseWriter, fileKey st
 
 // sortObjects sorts folders and files based on the given criteria
 func sortObjects(folders, files []S3Object, sortBy, sortOrder string) []S3Object {
-	// Sort folders by name only
+	// Sort folders by name, or by size or date once summarized; folders
+	// without a summary tie and fall back to their names
 	sort.Slice(folders, func(i, j int) bool {
+		a, b := folders[i], folders[j]
 		if sortOrder == sortOrderDesc {
-			return folders[i].Name > folders[j].Name
+			a, b = b, a
 		}
-		return folders[i].Name < folders[j].Name
+		switch {
+		case sortBy == "date" && !a.ModTime.Equal(b.ModTime):
+			return a.ModTime.Before(b.ModTime)
+		case sortBy == "size" && a.Size != b.Size:
+			return a.Size < b.Size
+		}
+		return a.Name < b.Name
 	})
 
 	// Sort files by selected column
@@ -330,14 +475,14 @@ func paginateObjects(allItems []S3Object, page, limit int) ([]S3Object, int, int
 	return allItems[start:end], totalPages, total
 }
 
-// generateBreadcrumbs creates the breadcrumb navigation
-func generateBreadcrumbs(prefix, sortOrder string, limit int) []Breadcrumb {
-	if prefix == "" {
-		return nil
-	}
-
+// generateBreadcrumbs creates the breadcrumb navigation, starting at the bucket
+func generateBreadcrumbs(bucketTitle, prefix, sortOrder string, limit int) []Breadcrumb {
 	parts := strings.Split(strings.TrimSuffix(prefix, "/"), "/")
-	breadcrumbs := make([]Breadcrumb, 0, len(parts))
+	breadcrumbs := make([]Breadcrumb, 0, len(parts)+1)
+	breadcrumbs = append(breadcrumbs, Breadcrumb{
+		Name: bucketTitle,
+		Path: fmt.Sprintf("?prefix=&page=1&sort=%s&limit=%d", sortOrder, limit),
+	})
 	accum := ""
 	for _, part := range parts {
 		if part == "" {
@@ -368,7 +513,7 @@ func getParentPrefix(prefix string) string {
 }
 
 // addFileMetadata adds type and S3 URL to file objects
-func addFileMetadata(items []S3Object) {
+func addFileMetadata(items []S3Object, store ObjectStore) {
 	for i := range items {
 		if !items[i].IsDirectory {
 			if idx := strings.LastIndex(items[i].Name, "."); idx != -1 {
@@ -376,66 +521,197 @@ func addFileMetadata(items []S3Object) {
 			} else {
 				items[i].Type = "file"
 			}
-			items[i].S3URL = "https://geonet-open-data.s3-ap-southeast-2.amazonaws.com/" + items[i].Key
+			items[i].S3URL = store.URL(items[i].Key)
 		}
 	}
 }
 
-// handleBrowserUI handles the browser UI rendering
-func handleBrowserUI(w fsthttp.ResponseWriter, prefix string, page int, sortBy string, sortOrder string, limit int, tmpl *template.Template) error {
-	objects, err := listObjects(prefix)
-	if err != nil {
-		w.WriteHeader(fsthttp.StatusInternalServerError)
-		if _, err := fmt.Fprintf(w, "Error listing objects: %v\n", err); err != nil {
-			fmt.Printf("Error writing response: %v\n", err)
+// listing is one page of a folder listing
+type listing struct {
+	Items []S3Object
+	cursorNav
+	Page, TotalPages, Total int
+	Limit                   int  // the page size, at most the bucket's MaxListItems
+	Cursored                bool // paged with cursors, without totals
+	Truncated               bool // the full listing stopped at MaxListItems
+	SummarySortPartial      bool // folders were too many to sort by their summaries
+}
+
+// fetchListing lists one page of the folder at prefix.
+//
+// Name-ascending listings are paged with cursors so that only the S3 pages
+// needed for the requested page are fetched; entries then appear in key
+// order rather than folders first. Other sort orders need the whole folder
+// and list at most the bucket's MaxListItems entries, as do filtered
+// listings. The page size is capped at MaxListItems too.
+func fetchListing(ctx context.Context, b bucketView, prefix string, page int, sortBy, sortOrder string, limit int, c listCursor, filter listFilter) (*listing, error) {
+	l := &listing{Page: page, Limit: min(limit, b.maxListItems())}
+	if sortBy == "name" && sortOrder == sortOrderAsc && page == 1 && !filter.Active() {
+		items, more, err := listObjectsPage(ctx, b.Store, prefix, c.After, l.Limit, b.maxListItems())
+		if err != nil {
+			return nil, err
+		}
+		if filter.Summary {
+			if _, err := addFolderSummaries(ctx, b, items); err != nil {
+				return nil, err
+			}
+		}
+		l.Items = items
+		l.Cursored = true
+		l.cursorNav = newCursorNav(c, items, more)
+	} else {
+		objects, capped, err := listObjects(ctx, b.Store, prefix, b.maxListItems())
+		if err != nil {
+			return nil, err
+		}
+		l.Truncated = capped
+		if filter.Deleted {
+			deleted, capped, err := listDeleted(ctx, b.Store, prefix, b.maxListItems())
+			if err != nil {
+				return nil, err
+			}
+			l.Truncated = l.Truncated || capped
+			objects = append(objects, deleted...)
+		}
+		objects = filter.Apply(objects)
+		// Folders sort by size or date only when all of them can be
+		// summarized; otherwise they stay in name order and only the folders
+		// on the page are summarized, after paging
+		summarizePage := false
+		if filter.Summary {
+			if countFolders(objects) <= maxSummaryFolders {
+				if _, err := addFolderSummaries(ctx, b, objects); err != nil {
+					return nil, err
+				}
+			} else {
+				summarizePage = true
+				l.SummarySortPartial = sortBy != "name"
+			}
+		}
+
+		// Separate folders and files
+		var folders, files []S3Object
+		for _, obj := range objects {
+			if obj.IsDirectory {
+				folders = append(folders, obj)
+			} else {
+				files = append(files, obj)
+			}
+		}
+
+		// Sort and paginate objects
+		allItems := sortObjects(folders, files, sortBy, sortOrder)
+		l.Items, l.TotalPages, l.Total = paginateObjects(allItems, page, l.Limit)
+		l.Page = min(page, max(l.TotalPages, 1))
+		if summarizePage {
+			if _, err := addFolderSummaries(ctx, b, l.Items); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Add metadata to files
+	addFileMetadata(l.Items, b.Store)
+	return l, nil
+}
+
+// handleBrowserUI handles the browser UI rendering. The listing is rendered
+// as HTML, or as JSON, plain text or CSV when format asks for it. Invalid
+// filter values are shown above the listing, or fail the other formats.
+func handleBrowserUI(ctx context.Context, w http.ResponseWriter, b bucketView, prefix string, page int, sortBy string, sortOrder string, limit int, cursor, format string, filter listFilter, filterErrs []string, tmpl *template.Template) error {
+	ctx, cacheStatus := withCacheStatus(ctx)
+	w.Header().Set("Vary", "Accept")
+
+	if len(filterErrs) > 0 && format != formatHTML {
+		err := errors.New(strings.Join(filterErrs, " "))
+		if format == formatJSON {
+			writeJSONError(w, http.StatusBadRequest, err)
+		} else {
+			writeErrorf(w, http.StatusBadRequest, "%v\n", err)
 		}
 		return err
 	}
 
-	// Separate folders and files
-	var folders, files []S3Object
-	for _, obj := range objects {
-		if obj.IsDirectory {
-			folders = append(folders, obj)
+	// Text and CSV are for scripts and spreadsheets, which get the whole
+	// folder rather than one page of it
+	whole := format == formatText || format == formatCSV
+	if whole {
+		page, limit, cursor = 1, b.maxListItems(), ""
+	}
+
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		if format == formatJSON {
+			writeJSONError(w, http.StatusBadRequest, err)
 		} else {
-			files = append(files, obj)
+			writeErrorf(w, http.StatusBadRequest, "%v\n", err)
 		}
+		return err
+	}
+	l, err := fetchListing(ctx, b, prefix, page, sortBy, sortOrder, limit, c, filter)
+	if err != nil {
+		if format == formatJSON {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("listing objects: %w", err))
+			return err
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, err := fmt.Fprintf(w, "Error listing objects: %v\n", err); err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+		}
+		return err
+	}
+	limit = l.Limit
+	cacheStatus.SetHeader(w.Header())
+	if whole && (l.Truncated || l.HasNext) {
+		w.Header().Set(listTruncatedHeader, "true")
 	}
 
-	// Sort and paginate objects
-	allItems := sortObjects(folders, files, sortBy, sortOrder)
-	pageItems, totalPages, total := paginateObjects(allItems, page, limit)
+	switch format {
+	case formatJSON:
+		return writeJSON(w, newAPIListing(b, prefix, sortBy, sortOrder, l))
+	case formatText:
+		return writeListingText(w, l)
+	case formatCSV:
+		return writeListingCSV(w, l)
+	}
 
 	// Generate navigation elements
-	breadcrumbs := generateBreadcrumbs(prefix, sortOrder, limit)
+	breadcrumbs := generateBreadcrumbs(b.Title, prefix, sortOrder, limit)
 	parentPrefix := getParentPrefix(prefix)
 
-	// Add metadata to files
-	addFileMetadata(pageItems)
-
 	// Set content type and render template
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if len(filterErrs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
 	data := PageData{
-		Objects:      pageItems,
+		Objects:      l.Items,
 		Breadcrumbs:  breadcrumbs,
 		CurrentPath:  prefix,
 		ParentPrefix: parentPrefix,
+		Title:        b.Title,
+		BasePath:     b.BasePath,
+		HomeURL:      b.HomeURL,
 	}
-	if err := tmpl.Execute(w, struct {
-		PageData
-		Page, TotalPages, Limit, Total int
-		SortOrder, SortBy, Prefix      string
-	}{
-		PageData:   data,
-		Page:       page,
-		TotalPages: totalPages,
-		Limit:      limit,
-		Total:      total,
-		SortOrder:  sortOrder,
-		SortBy:     sortBy,
-		Prefix:     prefix,
+	if err := tmpl.Execute(w, browserPage{
+		PageData:           data,
+		cursorNav:          l.cursorNav,
+		Page:               l.Page,
+		TotalPages:         l.TotalPages,
+		Limit:              limit,
+		Total:              l.Total,
+		SortOrder:          sortOrder,
+		SortBy:             sortBy,
+		Prefix:             prefix,
+		Truncated:          l.Truncated,
+		MaxListItems:       b.maxListItems(),
+		SummarySortPartial: l.SummarySortPartial,
+		Filter:             filter.Raw,
+		FilterQuery:        filter.Query(),
+		FilterActive:       filter.Active(),
+		FilterErrors:       filterErrs,
 	}); err != nil {
-		w.WriteHeader(fsthttp.StatusInternalServerError)
+		w.WriteHeader(http.StatusInternalServerError)
 		if _, err := fmt.Fprintf(w, "Error rendering template: %v\n", err); err != nil {
 			fmt.Printf("Error writing response: %v\n", err)
 		}
@@ -444,6 +720,41 @@ func handleBrowserUI(w fsthttp.ResponseWriter, prefix string, page int, sortBy s
 	return nil
 }
 
+// browserPage is the data passed to the browser page template
+type browserPage struct {
+	PageData
+	cursorNav
+	Page, TotalPages, Limit, Total int
+	SortOrder, SortBy, Prefix      string
+	Truncated                      bool // the full listing stopped at MaxListItems
+	MaxListItems                   int
+	SummarySortPartial             bool
+
+	Filter       filterValues // submitted filter values, for the filter bar
+	FilterQuery  template.URL // the filter as "&name=value" pairs for links
+	FilterActive bool
+	FilterErrors []string
+}
+
+// cursorNav holds the previous/next links of a cursor-paged listing
+type cursorNav struct {
+	HasPrev, HasNext       bool
+	PrevCursor, NextCursor string
+}
+
+func newCursorNav(c listCursor, items []S3Object, more bool) cursorNav {
+	nav := cursorNav{HasPrev: !c.IsFirst(), PrevCursor: c.Prev().Encode()}
+	if more && len(items) > 0 {
+		nav.HasNext = true
+		nav.NextCursor = c.Next(items[len(items)-1].Key).Encode()
+	}
+	return nav
+}
+
+// maxPageLimit is the largest page a request can ask for. Listings are
+// further capped at the bucket's max_list_items.
+const maxPageLimit = 1000
+
 // parseQueryParams extracts and validates query parameters from the request
 func parseQueryParams(q url.Values) (prefix string, page, limit int, sortBy, sortOrder string) {
 	prefix = q.Get("prefix")
@@ -470,14 +781,14 @@ func parseQueryParams(q url.Values) (prefix string, page, limit int, sortBy, sor
 	if limit < 1 {
 		limit = 25
 	}
+	limit = min(limit, maxPageLimit)
 
 	return prefix, page, limit, sortBy, sortOrder
 }
 
-func main() {
-	// Log service version
-	fmt.Println("FASTLY_SERVICE_VERSION:", os.Getenv("FASTLY_SERVICE_VERSION"))
-
+// newTemplate parses the browser page template with its helper functions,
+// along with the other page templates sharing its style
+func newTemplate() *template.Template {
 	tmpl := template.Must(template.New("browser").Funcs(template.FuncMap{
 		"formatSize": formatSize,
 		"add":        add,
@@ -485,45 +796,337 @@ func main() {
 		"inc":        inc,
 		"until":      until,
 		"slice":      slice,
+		"row":        newTableRow,
+		"searchForm": newSearchForm,
 	}).Parse(htmlTemplate))
+	template.Must(tmpl.New("landing").Parse(landingTemplate))
+	template.Must(tmpl.New("search").Parse(searchTemplate))
+	template.Must(tmpl.New("meta").Parse(metaTemplate))
+	template.Must(tmpl.New("history").Parse(historyTemplate))
+	template.Must(tmpl.New("notfound").Parse(notFoundTemplate))
+	template.Must(tmpl.New("archive_error").Parse(archiveErrorTemplate))
+	return tmpl
+}
 
-	fsthttp.ServeFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+// newHandler returns the request dispatcher shared by the Fastly Compute and
+// standalone net/http entry points
+func newHandler(reg *bucketRegistry, tmpl *template.Template) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Handle health check endpoint
 		if r.URL.Path == "/health" {
 			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(fsthttp.StatusOK)
+			w.WriteHeader(http.StatusOK)
 			if _, err := fmt.Fprintf(w, `{"status":"ok","version":"%s"}`, os.Getenv("FASTLY_SERVICE_VERSION")); err != nil {
 				fmt.Printf("Error writing health check response: %v\n", err)
 			}
 			return
 		}
 
+		// Other methods are only answered by the WebDAV frontend
+		if r.Method != "GET" && !isDAVMethod(r.Method) {
+			writeMethodNotAllowed(w)
+			return
+		}
+
+		// Tenant hostnames are confined to their own bucket, served at the root
+		if b, ok := reg.ForHost(r.Host); ok {
+			if b == nil {
+				handleNotFound(w, fmt.Sprintf("No bucket is configured for %s.", r.Host), tmpl)
+				return
+			}
+			serveBucket(w, r, bucketView{Bucket: b, BasePath: "/"}, strings.TrimPrefix(r.URL.Path, "/"), tmpl)
+			return
+		}
+
+		// Per-bucket routes: /b/<id>/...
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/b/"); ok {
+			id, rel, hasSlash := strings.Cut(rest, "/")
+			if b := reg.Get(id); b != nil {
+				if !hasSlash {
+					http.Redirect(w, r, "/b/"+id+"/", http.StatusMovedPermanently)
+					return
+				}
+				serveBucket(w, r, bucketView{Bucket: b, BasePath: "/b/" + id + "/", HomeURL: "/"}, rel, tmpl)
+				return
+			}
+			// With a single bucket served at the root, /b/... may be a key
+			if len(reg.Buckets) > 1 {
+				handleNotFound(w, fmt.Sprintf("Unknown bucket %q.", id), tmpl)
+				return
+			}
+		}
+
+		// A single bucket is served at the root, several get a landing page
+		if len(reg.Buckets) == 1 {
+			serveBucket(w, r, bucketView{Bucket: reg.Buckets[0], BasePath: "/"}, strings.TrimPrefix(r.URL.Path, "/"), tmpl)
+			return
+		}
 		if r.Method != "GET" {
-			w.WriteHeader(fsthttp.StatusMethodNotAllowed)
-			if _, err := fmt.Fprintf(w, "Method not allowed\n"); err != nil {
-				fmt.Printf("Error writing response: %v\n", err)
+			writeMethodNotAllowed(w)
+			return
+		}
+		if r.URL.Path != "/" {
+			handleNotFound(w, "The requested page does not exist.", tmpl)
+			return
+		}
+		if err := handleLanding(w, reg, tmpl); err != nil {
+			return
+		}
+	})
+}
+
+// toolNamespace is the path, relative to a bucket, reserved for the
+// browser's own pages and APIs. Keys below it cannot be fetched through the
+// file proxy.
+const toolNamespace = "_/"
+
+// serveBucket dispatches a request for a single bucket. rel is the request
+// path relative to the bucket's base path.
+func serveBucket(w http.ResponseWriter, r *http.Request, b bucketView, rel string, tmpl *template.Template) {
+	ctx := r.Context()
+
+	// The browser's own pages and APIs live under the reserved _/ path, so
+	// that they never hide an object
+	if tool, ok := strings.CutPrefix(rel, toolNamespace); ok {
+		serveTool(w, r, b, tool, tmpl)
+		return
+	}
+
+	// Parse query params
+	prefix, page, limit, sortBy, sortOrder := parseQueryParams(r.URL.Query())
+	cursor := r.URL.Query().Get("cursor")
+
+	filter, filterErrs := parseFilter(r.URL.Query())
+
+	if r.Method != "GET" {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	// If this is a file request (no prefix param, path does not end with / and is not the bucket root), proxy the file
+	if prefix == "" && rel != "" && !strings.HasSuffix(rel, "/") {
+		if err := handleFileRequest(ctx, w, b.Store, rel, GetOptions{Range: r.Header.Get("Range"), VersionID: r.URL.Query().Get("versionId")}); err != nil {
+			return
+		}
+		return
+	}
+
+	// Otherwise, render the browser UI for the given prefix or folder in the
+	// format the client accepts
+	format := negotiateFormat(r.Header.Get("Accept"))
+	if err := handleBrowserUI(ctx, w, b, prefix, page, sortBy, sortOrder, limit, cursor, format, filter, filterErrs, tmpl); err != nil {
+		return
+	}
+}
+
+// serveTool dispatches a request for one of the browser's own pages or APIs.
+// tool is the request path below the tool namespace.
+// serveTool dispatches a request for one of the browser's own pages or APIs.
+// tool is the request path below the tool namespace.
+// serveTool dispatches a request for one of the browser's own pages or APIs.
+// tool is the request path below the tool namespace.
+// serveTool dispatches a request for one of the browser's own pages or APIs.
+// tool is the request path below the tool namespace.
+// serveTool dispatches a request for one of the browser's own pages or APIs.
+// tool is the request path below the tool namespace.
+// serveTool dispatches a request for one of the browser's own pages or APIs.
+// tool is the request path below the tool namespace.
+func serveTool(w http.ResponseWriter, r *http.Request, b bucketView, tool string, tmpl *template.Template) {
+	ctx := r.Context()
+
+	// Parse query params
+	prefix, page, limit, sortBy, sortOrder := parseQueryParams(r.URL.Query())
+	cursor := r.URL.Query().Get("cursor")
+
+	filter, filterErrs := parseFilter(r.URL.Query())
+
+	// Read-only WebDAV frontend
+	if davPath, ok := strings.CutPrefix(tool, "dav"); ok && (davPath == "" || strings.HasPrefix(davPath, "/")) {
+		if err := handleDAV(ctx, w, r, b, davPath); err != nil {
+			return
+		}
+		return
+	}
+
+	// Autoindex-style listings for crawlers, which also HEAD their files
+	if key, ok := strings.CutPrefix(tool, "index/"); ok && (r.Method == "GET" || r.Method == "HEAD") {
+		if err := handleAutoindex(ctx, w, r, b, key); err != nil {
+			return
+		}
+		return
+	}
+	if tool == "index" && r.Method == "GET" {
+		http.Redirect(w, r, b.BasePath+toolNamespace+"index/", http.StatusMovedPermanently)
+		return
+	}
+
+	if r.Method != "GET" {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	// JSON listing API, served relative to the bucket
+	if tool == "api/list" || tool == "api/v1/list" {
+		if err := handleAPIList(ctx, w, b, prefix, page, sortBy, sortOrder, limit, cursor, filter, filterErrs); err != nil {
+			return
+		}
+		return
+	}
+
+	// Recursive NDJSON listing
+	if tool == "api/keys" || tool == "api/v1/keys" {
+		maxItems := 0
+		if v := r.URL.Query().Get("max"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid max %q: want a positive integer", v))
+				return
 			}
+			maxItems = n
+		}
+		if err := handleAPIKeys(ctx, w, b, prefix, r.URL.Query().Get("start_after"), maxItems); err != nil {
+			return
+		}
+		return
+	}
+
+	// Recursive folder summary
+	if tool == "api/summary" || tool == "api/v1/summary" {
+		if err := handleAPISummary(ctx, w, b, prefix); err != nil {
+			return
+		}
+		return
+	}
+
+	// Atom feed of recently modified files
+	if tool == "feed.atom" {
+		if err := handleFeed(ctx, w, r, b, prefix, limit); err != nil {
+			return
+		}
+		return
+	}
+
+	// Folder download as a ZIP archive
+	if tool == "zip" {
+		if err := handleZip(ctx, w, b, prefix, tmpl); err != nil {
+			return
+		}
+		return
+	}
+
+	// Folder download as a tar archive, optionally gzipped
+	if tool == "tar" || tool == "tar.gz" {
+		if err := handleTar(ctx, w, b, prefix, tool == "tar.gz", tmpl); err != nil {
 			return
 		}
+		return
+	}
 
-		// Parse query params
-		u, _ := url.Parse(r.URL.String())
-		prefix, page, limit, sortBy, sortOrder := parseQueryParams(u.Query())
+	// Folder listing as a Metalink or a wget URL list
+	if tool == "export.meta4" || tool == "export.txt" {
+		if err := handleExport(ctx, w, r, b, prefix, strings.TrimPrefix(tool, "export."), tmpl); err != nil {
+			return
+		}
+		return
+	}
 
-		// If this is a file request (no prefix param, path does not end with / and is not "/"), proxy the file
-		if prefix == "" && r.URL.Path != "/" && !strings.HasSuffix(r.URL.Path, "/") {
-			fileKey := strings.TrimPrefix(r.URL.Path, "/")
-			if err := handleFileRequest(ctx, w, fileKey); err != nil {
+	// Checksum manifest of a folder, or a check of a single object
+	if tool == "manifest" || tool == "api/manifest" {
+		q := r.URL.Query()
+		format := formatJSON
+		if tool == "manifest" {
+			w.Header().Set("Vary", "Accept")
+			if negotiateFormat(r.Header.Get("Accept")) != formatJSON {
+				format = formatText
+			}
+		}
+		algo, err := parseManifestAlgo(q.Get("algo"))
+		if err != nil {
+			if format == formatJSON {
+				writeJSONError(w, http.StatusBadRequest, err)
+			} else {
+				writeErrorf(w, http.StatusBadRequest, "%v\n", err)
+			}
+			return
+		}
+		if key := q.Get("verify"); key != "" {
+			if err := handleVerify(ctx, w, b, key, algo, q.Get("expect"), format); err != nil {
 				return
 			}
 			return
 		}
+		if err := handleManifest(ctx, w, b, prefix, algo, format); err != nil {
+			return
+		}
+		return
+	}
 
-		// Otherwise, render the browser UI for the given prefix or folder
-		if err := handleBrowserUI(w, prefix, page, sortBy, sortOrder, limit, tmpl); err != nil {
+	// Filename search
+	if tool == "search" {
+		q := r.URL.Query()
+		if err := handleSearch(ctx, w, b, prefix, q.Get("q"), q.Get("mode"), q.Get("after"), limit, tmpl); err != nil {
 			return
 		}
-	})
+		return
+	}
+
+	// Object metadata page, or its JSON form under the API path
+	if key, ok := strings.CutPrefix(tool, "meta/"); ok && key != "" {
+		w.Header().Set("Vary", "Accept")
+		format := formatHTML
+		if negotiateFormat(r.Header.Get("Accept")) == formatJSON {
+			format = formatJSON
+		}
+		if err := handleMeta(ctx, w, b, key, limit, format, tmpl); err != nil {
+			return
+		}
+		return
+	}
+	if key, ok := strings.CutPrefix(tool, "api/meta/"); ok && key != "" {
+		if err := handleMeta(ctx, w, b, key, limit, formatJSON, tmpl); err != nil {
+			return
+		}
+		return
+	}
+
+	// Version history of a file, likewise
+	if key, ok := strings.CutPrefix(tool, "history/"); ok && key != "" {
+		w.Header().Set("Vary", "Accept")
+		format := formatHTML
+		if negotiateFormat(r.Header.Get("Accept")) == formatJSON {
+			format = formatJSON
+		}
+		if err := handleHistory(ctx, w, b, key, limit, format, tmpl); err != nil {
+			return
+		}
+		return
+	}
+	if key, ok := strings.CutPrefix(tool, "api/history/"); ok && key != "" {
+		if err := handleHistory(ctx, w, b, key, limit, formatJSON, tmpl); err != nil {
+			return
+		}
+		return
+	}
+
+	handleNotFound(w, "The requested page does not exist.", tmpl)
+}
+
+// writeMethodNotAllowed rejects a method outside of the WebDAV frontend
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	w.Header().Set("Allow", "GET")
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	if _, err := fmt.Fprintf(w, "Method not allowed\n"); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+	}
+}
+
+// writeErrorf writes a plain text error response
+func writeErrorf(w http.ResponseWriter, status int, format string, args ...any) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := fmt.Fprintf(w, format, args...); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+	}
 }
 
 // Add template helpers for slice, until, add, dec, inc
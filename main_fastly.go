@@ -0,0 +1,108 @@
+//go:build wasip1
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/fastly/compute-sdk-go/configstore"
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/secretstore"
+)
+
+// The entry point when running on Fastly Compute.
+//
+// Requests to S3 are sent through each bucket's configured backend via an
+// fsthttp.Transport, and the shared net/http handler is adapted to fsthttp.
+func main() {
+	// Log service version
+	fmt.Println("FASTLY_SERVICE_VERSION:", os.Getenv("FASTLY_SERVICE_VERSION"))
+
+	cfg, cfgErr := loadFastlyConfig()
+	if cfgErr != nil {
+		fmt.Printf("Configuration error: %v\n", cfgErr)
+		fsthttp.ServeFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+			w.WriteHeader(fsthttp.StatusInternalServerError)
+			if _, err := fmt.Fprintf(w, "Configuration error: %v\n", cfgErr); err != nil {
+				fmt.Printf("Error writing response: %v\n", err)
+			}
+		})
+		return
+	}
+
+	cache := &fastlyCache{}
+	reg := newBucketRegistryFromConfig(cfg, func(bc BucketConfig) *http.Client {
+		return &http.Client{Transport: fsthttp.NewTransport(bc.Backend)}
+	}, cache)
+
+	handler := fsthttp.Adapt(newHandler(reg, newTemplate()))
+	fsthttp.ServeFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		handler.ServeHTTP(ctx, w, r)
+		// Send the response before refreshing stale listings
+		if err := w.Close(); err != nil {
+			fmt.Printf("Error closing response: %v\n", err)
+		}
+		cache.RunBackground()
+	})
+}
+
+// loadFastlyConfig reads the configuration from the Fastly Config Store and
+// bucket credentials from the Fastly Secret Store. The Secret Store is
+// optional when only public buckets are configured, and a service without
+// the Config Store serves the built-in bucket.
+func loadFastlyConfig() (Config, error) {
+	store, err := configstore.Open(configStoreName)
+	if errors.Is(err, configstore.ErrStoreNotFound) {
+		fmt.Printf("Config store %q not found, serving the built-in bucket\n", configStoreName)
+		return loadConfig(func(key string) (string, bool) {
+			v, ok := builtinSettings[key]
+			return v, ok
+		}, func(string) (string, bool) { return "", false })
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("opening config store %q: %w", configStoreName, err)
+	}
+	secrets, err := secretstore.Open(secretStoreName)
+	if err != nil && !errors.Is(err, secretstore.ErrSecretStoreNotFound) {
+		return Config{}, fmt.Errorf("opening secret store %q: %w", secretStoreName, err)
+	}
+
+	var lookupErr error
+	cfg, err := loadConfig(func(key string) (string, bool) {
+		v, err := store.Get(key)
+		if err != nil {
+			if !errors.Is(err, configstore.ErrKeyNotFound) && lookupErr == nil {
+				lookupErr = fmt.Errorf("reading %q from config store %q: %w", key, configStoreName, err)
+			}
+			return "", false
+		}
+		return v, true
+	}, func(key string) (string, bool) {
+		if secrets == nil {
+			return "", false
+		}
+		secret, err := secrets.Get(key)
+		if err != nil {
+			if !errors.Is(err, secretstore.ErrSecretNotFound) && lookupErr == nil {
+				lookupErr = fmt.Errorf("reading %q from secret store %q: %w", key, secretStoreName, err)
+			}
+			return "", false
+		}
+		v, err := secret.Plaintext()
+		if err != nil {
+			if lookupErr == nil {
+				lookupErr = fmt.Errorf("decrypting %q from secret store %q: %w", key, secretStoreName, err)
+			}
+			return "", false
+		}
+		return string(v), true
+	})
+	if lookupErr != nil {
+		return Config{}, lookupErr
+	}
+	return cfg, err
+}
@@ -0,0 +1,59 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// The entry point when running as a standalone net/http server, e.g. on a VM
+// or in a container. The listen address is taken from the ADDR environment
+// variable and defaults to :8080.
+func main() {
+	addr := os.Getenv("ADDR")
+	if addr == "" {
+		addr = ":8080"
+	}
+
+	cfg, err := loadConfig(envLookup, envLookup)
+	if err != nil {
+		fmt.Printf("Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Only connecting and waiting for headers are bounded: bodies of proxied
+	// files and archives may stream for as long as the client keeps reading,
+	// and are cut off through the request context when it goes away
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+		ForceAttemptHTTP2:     true,
+	}}
+	reg := newBucketRegistryFromConfig(cfg, func(BucketConfig) *http.Client { return client }, newMemoryCache())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           newHandler(reg, newTemplate()),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	fmt.Printf("Listening on %s\n", addr)
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Printf("Error starting server: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// envLookup reads configuration keys from S3BROWSER_* environment variables
+func envLookup(key string) (string, bool) {
+	name := "S3BROWSER_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+	return os.LookupEnv(name)
+}
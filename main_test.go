@@ -3,9 +3,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"html/template"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
@@ -33,26 +34,17 @@ func TestRootHandlerReturnsHTML(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// Use a minimal handler for testing: just call the template with dummy data
-	tmpl := template.Must(template.New("test").Funcs(template.FuncMap{
-		"formatSize": formatSize,
-		"add":        add,
-		"dec":        dec,
-		"inc":        inc,
-		"until":      until,
-		"slice":      slice,
-	}).Parse(htmlTemplate))
+	tmpl := newTemplate()
 
 	data := PageData{
 		Objects:      []S3Object{},
 		Breadcrumbs:  []Breadcrumb{},
 		CurrentPath:  "",
 		ParentPrefix: "",
+		Title:        "Geonet Open Data Browser",
+		BasePath:     "/",
 	}
-	resp := struct {
-		PageData
-		Page, TotalPages, Limit, Total int
-		SortOrder, SortBy, Prefix      string
-	}{
+	resp := browserPage{
 		PageData:   data,
 		Page:       1,
 		TotalPages: 1,
@@ -95,13 +87,7 @@ func TestHealthCheck(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// Call the handler directly
-	if req.URL.Path == "/health" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if _, err := fmt.Fprintf(w, `{"status":"ok","version":"%s"}`, os.Getenv("FASTLY_SERVICE_VERSION")); err != nil {
-			t.Errorf("Error writing health check response: %v", err)
-		}
-	}
+	newHandler(newTestRegistry(newFakeStore(nil)), newTemplate()).ServeHTTP(w, req)
 
 	// Verify response
 	if w.Code != http.StatusOK {
@@ -122,3 +108,270 @@ func TestHealthCheck(t *testing.T) {
 		t.Errorf("Expected version 'test-version', got '%s'", response["version"])
 	}
 }
+
+// newTestRegistry returns a registry serving store as its only bucket
+func newTestRegistry(store ObjectStore) *bucketRegistry {
+	return newBucketRegistry("Test", []*Bucket{{ID: "test", Name: "test-bucket", Title: "Test Bucket", Store: store}})
+}
+
+// newFakeS3 starts an httptest server that answers ListObjects requests with
+// a fixed listing and serves a single object
+func newFakeS3(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/" && r.URL.Query().Get("prefix") == "data/":
+			w.Header().Set("Content-Type", "application/xml")
+			if _, err := io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Prefix>data/</Prefix>
+  <IsTruncated>false</IsTruncated>
+  <CommonPrefixes><Prefix>data/2024/</Prefix></CommonPrefixes>
+  <Contents><Key>data/readme.txt</Key><LastModified>2024-05-01T10:00:00.000Z</LastModified><Size>11</Size></Contents>
+</ListBucketResult>`); err != nil {
+				t.Errorf("write listing: %v", err)
+			}
+		case r.URL.Path == "/data/readme.txt":
+			if got := r.Header.Get("Range"); got != "bytes=0-4" {
+				t.Errorf("Range header = %q, want %q", got, "bytes=0-4")
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusPartialContent)
+			if _, err := io.WriteString(w, "hello"); err != nil {
+				t.Errorf("write object: %v", err)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHandlerEndToEnd(t *testing.T) {
+	s3 := newFakeS3(t)
+	srv := httptest.NewServer(newHandler(newTestRegistry(newS3Store(s3.Client(), s3.URL)), newTemplate()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/?prefix=data/")
+	if err != nil {
+		t.Fatalf("GET listing: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("listing status = %d, body: %s", resp.StatusCode, body)
+	}
+	for _, want := range []string{"2024", "readme.txt", "11 B"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("listing does not contain %q", want)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/data/readme.txt", nil)
+	req.Header.Set("Range", "bytes=0-4")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET file: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "hello" {
+		t.Errorf("file response = %d %q, want 206 %q", resp.StatusCode, body, "hello")
+	}
+
+	resp, err = http.Post(srv.URL+"/", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestToolNamespace(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"search":         "a file named search",
+		"meta/notes.txt": "notes",
+		"dav/a.txt":      "dav",
+		"data/a.csv":     "abc",
+	})
+	handler := newHandler(newTestRegistry(store), newTemplate())
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		return rec
+	}
+
+	// Keys named like tools are plain files
+	for key, want := range map[string]string{"search": "a file named search", "meta/notes.txt": "notes", "dav/a.txt": "dav"} {
+		if rec := get("/" + key); rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("GET /%s = %d %q, want %q", key, rec.Code, rec.Body, want)
+		}
+	}
+
+	for _, path := range []string{"/_/search?q=notes", "/_/meta/search", "/_/api/summary?prefix=data/"} {
+		if rec := get(path); rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", path, rec.Code)
+		}
+	}
+	if rec := get("/_/nothing"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /_/nothing = %d, want 404", rec.Code)
+	}
+}
+
+func TestMultiBucketRouting(t *testing.T) {
+	reg := newBucketRegistry("Open Data", []*Bucket{
+		{ID: "one", Name: "bucket-one", Title: "Bucket One", Store: newFakeStore(map[string]string{"a/1.txt": "one"})},
+		{ID: "two", Name: "bucket-two", Title: "Bucket Two", Store: &prefixedStore{
+			ObjectStore: newFakeStore(map[string]string{"public/x/2.txt": "two", "private/secret.txt": "no"}),
+			root:        "public/",
+		}},
+	})
+	h := newHandler(reg, newTemplate())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	landing := get("/")
+	for _, want := range []string{"Open Data", `href="/b/one/"`, "Bucket Two", "bucket-two"} {
+		if !strings.Contains(landing.Body.String(), want) {
+			t.Errorf("landing page does not contain %q", want)
+		}
+	}
+
+	listing := get("/b/two/?prefix=x/")
+	body := listing.Body.String()
+	if !strings.Contains(body, `href="/b/two/x/2.txt"`) {
+		t.Errorf("listing does not link files under the bucket base path: %s", body)
+	}
+	if !strings.Contains(body, "Bucket Two") || !strings.Contains(body, `<a href="/">Home</a>`) {
+		t.Errorf("breadcrumbs do not start at the bucket")
+	}
+
+	if w := get("/b/two/x/2.txt"); w.Body.String() != "two" {
+		t.Errorf("file proxy = %q, want %q", w.Body.String(), "two")
+	}
+	if w := get("/b/two/private/secret.txt"); w.Code != http.StatusNotFound {
+		t.Errorf("key outside root prefix status = %d, want 404", w.Code)
+	}
+	if w := get("/b/three/"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown bucket status = %d, want 404", w.Code)
+	}
+	if w := get("/b/one"); w.Code != http.StatusMovedPermanently {
+		t.Errorf("bucket without trailing slash status = %d, want 301", w.Code)
+	}
+}
+
+func TestHostRouting(t *testing.T) {
+	reg := newBucketRegistry("Open Data", []*Bucket{
+		{ID: "data", Name: "bucket-data", Title: "Data", Store: newFakeStore(map[string]string{"d.txt": "data"})},
+		{ID: "archive", Name: "bucket-archive", Title: "Archive", Store: newFakeStore(map[string]string{"a.txt": "archive"})},
+	})
+	for host, id := range map[string]string{"data.example.org": "data", "Archive.Example.org": "archive"} {
+		if err := reg.AddHost(host, id); err != nil {
+			t.Fatalf("AddHost(%q, %q): %v", host, id, err)
+		}
+	}
+	h := newHandler(reg, newTemplate())
+
+	cases := []struct {
+		host, path string
+		status     int
+		body       string
+	}{
+		{"data.example.org", "/d.txt", http.StatusOK, "data"},
+		{"archive.example.org:443", "/a.txt", http.StatusOK, "archive"},
+		{"archive.example.org", "/", http.StatusOK, "Archive"},
+		{"data.example.org", "/a.txt", http.StatusNotFound, "NoSuchKey"},
+		{"unknown.example.org", "/", http.StatusNotFound, "No bucket is configured for unknown.example.org"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Host = c.host
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.body) {
+			t.Errorf("GET %s%s = %d %q, want %d containing %q", c.host, c.path, w.Code, w.Body.String(), c.status, c.body)
+		}
+	}
+}
+
+func TestHandlerCursorPaging(t *testing.T) {
+	store := newFakeStore(map[string]string{"a.csv": "a", "b.csv": "b", "c.csv": "c"})
+	store.pageSize = 1
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	get := func(query string) string {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/?" + query)
+		if err != nil {
+			t.Fatalf("GET %s: %v", query, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s status = %d, body: %s", query, resp.StatusCode, body)
+		}
+		return string(body)
+	}
+
+	first := get("limit=2")
+	if !strings.Contains(first, "b.csv") || strings.Contains(first, "c.csv") {
+		t.Fatalf("first page does not hold exactly a.csv and b.csv")
+	}
+	next := listCursor{}.Next("b.csv").Encode()
+	if !strings.Contains(first, "cursor="+next) {
+		t.Fatalf("first page has no link to cursor %q", next)
+	}
+
+	second := get("cursor=" + next + "&limit=2")
+	if !strings.Contains(second, "c.csv") || strings.Contains(second, "a.csv") || strings.Contains(second, "Next ➡️") {
+		t.Errorf("second page should hold only c.csv and no next link")
+	}
+
+	resp, err := http.Get(srv.URL + "/?cursor=%21bad")
+	if err != nil {
+		t.Fatalf("GET bad cursor: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad cursor status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestListingLimitIsCapped(t *testing.T) {
+	objects := map[string]string{}
+	for i := range 300 {
+		objects[fmt.Sprintf("big/%04d.txt", i)] = "x"
+	}
+	fake := newFakeStore(objects)
+	fake.pageSize = 100
+	store := &countingStore{ObjectStore: fake}
+	reg := newBucketRegistry("Test", []*Bucket{{ID: "test", Title: "Test Bucket", Store: store, MaxListItems: 100}})
+	handler := newHandler(reg, newTemplate())
+
+	for _, query := range []string{"limit=100000", "limit=100000&sortby=size"} {
+		store.lists = 0
+		req := httptest.NewRequest("GET", "/?prefix=big/&"+query, nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var l apiListing
+		if err := json.Unmarshal(rec.Body.Bytes(), &l); err != nil {
+			t.Fatalf("%s: decoding: %v\n%s", query, err, rec.Body)
+		}
+		if len(l.Items) != 100 || store.lists > 2 {
+			t.Errorf("%s: %d items from %d List calls, want 100 items from at most 2", query, len(l.Items), store.lists)
+		}
+	}
+
+	if _, _, limit, _, _ := parseQueryParams(url.Values{"limit": {"100000"}}); limit != maxPageLimit {
+		t.Errorf("parsed limit = %d, want %d", limit, maxPageLimit)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Manifest algorithms: md5 is read from the ETags of a listing, sha256 is
+// computed by streaming every object through the edge
+const (
+	manifestMD5    = "md5"
+	manifestSHA256 = "sha256"
+)
+
+// apiManifest is the JSON form of a folder's checksum manifest. Files must
+// stay the last field: writeManifestJSON streams it after the others.
+type apiManifest struct {
+	Version   int                `json:"version"`
+	Bucket    string             `json:"bucket"`
+	Prefix    string             `json:"prefix"`
+	Algo      string             `json:"algo"`
+	Truncated bool               `json:"truncated"`
+	Files     []apiManifestEntry `json:"files"`
+}
+
+// apiManifestEntry is one file of a manifest. Path is relative to the
+// manifest's prefix, as in the text form.
+type apiManifestEntry struct {
+	Key          string `json:"key"`
+	Path         string `json:"path"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"last_modified"`
+	ETag         string `json:"etag,omitempty"`
+	MD5          string `json:"md5,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+	Multipart    bool   `json:"multipart,omitempty"` // the ETag is not an MD5 of the content
+	Error        string `json:"error,omitempty"`     // the object could not be read
+}
+
+// apiVerify is the result of checking a single object
+type apiVerify struct {
+	Version   int    `json:"version"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	ETag      string `json:"etag,omitempty"`
+	Algo      string `json:"algo"`
+	Checksum  string `json:"checksum"`
+	Expected  string `json:"expected,omitempty"`
+	Match     *bool  `json:"match,omitempty"`      // the checksum equals expected
+	ETagMatch *bool  `json:"etag_match,omitempty"` // the content's MD5 equals a single-part ETag
+	Encrypted bool   `json:"encrypted,omitempty"`  // SSE-KMS or SSE-C: the ETag is not an MD5
+	OK        bool   `json:"ok"`
+}
+
+// parseManifestAlgo validates the algo parameter, md5 by default
+func parseManifestAlgo(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", manifestMD5:
+		return manifestMD5, nil
+	case manifestSHA256:
+		return manifestSHA256, nil
+	}
+	return "", fmt.Errorf("invalid algo %q: want md5 or sha256", s)
+}
+
+// etagMD5 returns the MD5 a single-part ETag stands for. Multipart uploads
+// have ETags that are not an MD5 of the content, and so do SSE-KMS and SSE-C
+// objects, which a listing cannot tell apart: manifests and Metalink hashes
+// built from ETags are only as good as the ETags.
+func etagMD5(etag string) (string, bool) {
+	s := strings.ToLower(strings.Trim(etag, `"`))
+	if len(s) != md5.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+// checksumLine formats a line of md5sum/sha256sum output, escaping names
+// the way coreutils does
+func checksumLine(sum, name string) string {
+	if strings.ContainsAny(name, "\\\n") {
+		name = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(name)
+		return `\` + sum + "  " + name + "\n"
+	}
+	return sum + "  " + name + "\n"
+}
+
+// handleManifest serves /_/manifest, a checksum manifest of every file under
+// prefix: md5sum-style text that `md5sum -c` or `sha256sum -c` can check
+// from inside the folder, or JSON. Files the text form cannot vouch for are
+// listed as # comments.
+func handleManifest(ctx context.Context, w http.ResponseWriter, b bucketView, prefix, algo, format string) error {
+	prefix = archivePrefix(prefix)
+	writeError := func(status int, err error) {
+		if format == formatJSON {
+			writeJSONError(w, status, err)
+		} else {
+			writeErrorf(w, status, "%v\n", err)
+		}
+	}
+
+	var objects []ObjectInfo
+	truncated := false
+	var err error
+	if algo == manifestSHA256 {
+		// Every byte is read, so the archive limits apply
+		maxBytes, maxObjects := b.archiveLimits()
+		objects, err = archiveObjects(ctx, b.Store, prefix, maxBytes, maxObjects)
+		var limitErr *archiveLimitError
+		if errors.As(err, &limitErr) {
+			writeError(http.StatusForbidden, limitErr)
+			return err
+		}
+	} else {
+		maxItems := b.maxListItems()
+		err = walkObjects(ctx, b.Store, prefix, "", func(page []ObjectInfo) error {
+			for _, o := range page {
+				if strings.HasSuffix(o.Key, "/") {
+					continue
+				}
+				if len(objects) == maxItems {
+					truncated = true
+					return errStopWalk
+				}
+				objects = append(objects, o)
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		writeError(http.StatusInternalServerError, fmt.Errorf("listing objects: %w", err))
+		return err
+	}
+	if len(objects) == 0 {
+		writeError(http.StatusNotFound, fmt.Errorf("no files under /%s", prefix))
+		return fmt.Errorf("no files under %q", prefix)
+	}
+
+	// Each entry is worked out as it is written, so a sha256 manifest
+	// streams while the objects are read
+	entry := func(o ObjectInfo) apiManifestEntry {
+		e := apiManifestEntry{
+			Key:          o.Key,
+			Path:         strings.TrimPrefix(o.Key, prefix),
+			Size:         o.Size,
+			LastModified: o.LastModified.UTC().Format(time.RFC3339),
+			ETag:         o.ETag,
+		}
+		sum, ok := etagMD5(o.ETag)
+		e.Multipart = !ok && strings.Contains(o.ETag, "-")
+		if algo == manifestMD5 {
+			e.MD5 = sum
+			return e
+		}
+		sums, _, err := hashObject(ctx, b.Store, o.Key, manifestSHA256)
+		if err != nil {
+			e.Error = err.Error()
+		} else {
+			e.SHA256 = sums[manifestSHA256]
+		}
+		return e
+	}
+
+	if format == formatJSON {
+		m := apiManifest{Version: apiVersion, Bucket: b.ID, Prefix: prefix, Algo: algo, Truncated: truncated}
+		return writeManifestJSON(ctx, w, m, objects, entry, algo == manifestSHA256)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	for _, o := range objects {
+		e := entry(o)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var line string
+		switch {
+		case e.Error != "":
+			line = fmt.Sprintf("# %s: %s\n", e.Path, e.Error)
+		case algo == manifestSHA256:
+			line = checksumLine(e.SHA256, e.Path)
+		case e.MD5 != "":
+			line = checksumLine(e.MD5, e.Path)
+		case e.Multipart:
+			line = fmt.Sprintf("# %s: multipart ETag %s is not an MD5\n", e.Path, e.ETag)
+		default:
+			line = fmt.Sprintf("# %s: ETag %s is not an MD5\n", e.Path, e.ETag)
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+			return err
+		}
+		if algo == manifestSHA256 && flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if truncated {
+		if _, err := fmt.Fprintf(w, "# only the first %d files are listed\n", len(objects)); err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// writeManifestJSON writes m in the layout of writeJSON with the entries of
+// objects as its Files, encoding each one as soon as it is worked out rather
+// than holding the whole manifest. With flush set, each entry is flushed.
+func writeManifestJSON(ctx context.Context, w http.ResponseWriter, m apiManifest, objects []ObjectInfo, entry func(ObjectInfo) apiManifestEntry, flush bool) error {
+	m.Files = []apiManifestEntry{}
+	head, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	write := func(b []byte) error {
+		if _, err := w.Write(b); err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+			return err
+		}
+		return nil
+	}
+	// Open the files array in place of the empty one
+	if err := write(append(bytes.TrimSuffix(head, []byte("[]\n}")), '[')); err != nil {
+		return err
+	}
+	for i, o := range objects {
+		e := entry(o)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		b, err := json.MarshalIndent(e, "    ", "  ")
+		if err != nil {
+			return err
+		}
+		sep := ",\n    "
+		if i == 0 {
+			sep = "\n    "
+		}
+		if err := write(append([]byte(sep), b...)); err != nil {
+			return err
+		}
+		if flush && flusher != nil {
+			flusher.Flush()
+		}
+	}
+	return write([]byte("\n  ]\n}\n"))
+}
+
+// hashObject streams key from the origin through MD5 and, for sha256, also
+// SHA-256, returning the hex sums by algorithm and the object's headers
+func hashObject(ctx context.Context, store ObjectStore, key, algo string) (map[string]string, http.Header, error) {
+	resp, err := store.Get(ctx, key, GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeBody(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.Header, &originStatusError{resp.StatusCode}
+	}
+	hashes := map[string]hash.Hash{manifestMD5: md5.New()}
+	if algo == manifestSHA256 {
+		hashes[manifestSHA256] = sha256.New()
+	}
+	writers := make([]io.Writer, 0, len(hashes))
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), resp.Body); err != nil {
+		return nil, resp.Header, err
+	}
+	sums := make(map[string]string, len(hashes))
+	for name, h := range hashes {
+		sums[name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, resp.Header, nil
+}
+
+// encryptedETag reports whether the headers of a GET show server-side
+// encryption whose ETag is not an MD5 of the content
+func encryptedETag(h http.Header) bool {
+	return strings.HasPrefix(h.Get("X-Amz-Server-Side-Encryption"), "aws:kms") ||
+		h.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != ""
+}
+
+// originStatusError is a non-200 answer from the origin to a GET
+type originStatusError struct{ status int }
+
+func (e *originStatusError) Error() string {
+	return fmt.Sprintf("origin returned status %d", e.status)
+}
+
+// handleVerify serves /_/manifest?verify=<key>, which streams one object
+// through the edge to compute its checksum. The content's MD5 is compared
+// with a single-part ETag unless the object is encrypted with SSE-KMS or
+// SSE-C, and the checksum with expect when given; a failed comparison
+// answers 409 Conflict.
+func handleVerify(ctx context.Context, w http.ResponseWriter, b bucketView, key, algo, expect, format string) error {
+	sums, h, err := hashObject(ctx, b.Store, key, algo)
+	if err != nil {
+		status := http.StatusBadGateway
+		var statusErr *originStatusError
+		if errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound {
+			status = http.StatusNotFound
+			err = fmt.Errorf("not found: %s", key)
+		}
+		if format == formatJSON {
+			writeJSONError(w, status, err)
+		} else {
+			writeErrorf(w, status, "%v\n", err)
+		}
+		return err
+	}
+
+	v := apiVerify{
+		Version:  apiVersion,
+		Bucket:   b.ID,
+		Key:      key,
+		ETag:     h.Get("ETag"),
+		Algo:     algo,
+		Checksum: sums[algo],
+		Expected: strings.ToLower(strings.TrimSpace(expect)),
+		OK:       true,
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		v.Size = n
+	}
+	if v.Expected != "" {
+		match := v.Checksum == v.Expected
+		v.Match, v.OK = &match, v.OK && match
+	}
+	v.Encrypted = encryptedETag(h)
+	if sum, ok := etagMD5(v.ETag); ok && !v.Encrypted {
+		match := sums[manifestMD5] == sum
+		v.ETagMatch, v.OK = &match, v.OK && match
+	}
+
+	status := http.StatusOK
+	if !v.OK {
+		status = http.StatusConflict
+	}
+	if format == formatJSON {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		return writeJSON(w, v)
+	}
+
+	result := func(ok *bool) string {
+		switch {
+		case ok == nil:
+			return "not checked"
+		case *ok:
+			return "OK"
+		}
+		return "FAILED"
+	}
+	etagResult := result(v.ETagMatch)
+	switch {
+	case v.Encrypted:
+		etagResult = "encrypted, not checked"
+	case v.ETagMatch == nil && strings.Contains(v.ETag, "-"):
+		etagResult = "multipart, not checked"
+	}
+	text := checksumLine(v.Checksum, path.Base(key)) +
+		fmt.Sprintf("expected: %s\netag: %s\n", result(v.Match), etagResult)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := io.WriteString(w, text); err != nil {
+		fmt.Printf("Error writing response: %v\n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// multipartStore lists some keys with the ETags of multipart uploads
+type multipartStore struct {
+	*fakeStore
+	etags map[string]string
+}
+
+func (m multipartStore) List(ctx context.Context, opts ListOptions) (*ListPage, error) {
+	page, err := m.fakeStore.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i, o := range page.Objects {
+		if etag, ok := m.etags[o.Key]; ok {
+			page.Objects[i].ETag = etag
+		}
+	}
+	return page, nil
+}
+
+func TestManifest(t *testing.T) {
+	store := multipartStore{
+		fakeStore: newFakeStore(map[string]string{
+			"data/a b.csv":   "abc",
+			"data/big.bin":   "big",
+			"data/sub/c.csv": "c",
+		}),
+		etags: map[string]string{"data/big.bin": `"9b2cf535f27731c974343645a3985328-3"`},
+	}
+	handler := newHandler(newTestRegistry(store), newTemplate())
+	get := func(url, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/_/manifest?prefix=data", "")
+	want := fmt.Sprintf("%x  a b.csv\n# big.bin: multipart ETag \"9b2cf535f27731c974343645a3985328-3\" is not an MD5\n%x  sub/c.csv\n", md5.Sum([]byte("abc")), md5.Sum([]byte("c")))
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("md5 manifest = %d\n%s\nwant\n%s", rec.Code, rec.Body, want)
+	}
+
+	rec = get("/_/manifest?prefix=data/&algo=sha256", "")
+	want = fmt.Sprintf("%x  a b.csv\n%x  big.bin\n%x  sub/c.csv\n", sha256.Sum256([]byte("abc")), sha256.Sum256([]byte("big")), sha256.Sum256([]byte("c")))
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("sha256 manifest = %d\n%s\nwant\n%s", rec.Code, rec.Body, want)
+	}
+
+	rec = get("/_/manifest?prefix=data/", "application/json")
+	var m apiManifest
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatalf("parsing JSON manifest: %v\n%s", err, rec.Body)
+	}
+	if m.Algo != manifestMD5 || len(m.Files) != 3 || m.Files[1].Path != "big.bin" || !m.Files[1].Multipart || m.Files[1].MD5 != "" ||
+		m.Files[2].MD5 != fmt.Sprintf("%x", md5.Sum([]byte("c"))) {
+		t.Errorf("JSON manifest = %+v", m)
+	}
+
+	if rec = get("/_/api/manifest?prefix=data/&algo=crc32", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown algo = %d, want 400", rec.Code)
+	}
+	if rec = get("/_/manifest?prefix=missing/", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing folder = %d, want 404", rec.Code)
+	}
+}
+
+// watchedStore calls onGet before each Get
+type watchedStore struct {
+	ObjectStore
+	onGet func(key string)
+}
+
+func (s watchedStore) Get(ctx context.Context, key string, opts GetOptions) (*ObjectResponse, error) {
+	s.onGet(key)
+	return s.ObjectStore.Get(ctx, key, opts)
+}
+
+func TestManifestJSONStreams(t *testing.T) {
+	rec := httptest.NewRecorder()
+	store := watchedStore{ObjectStore: newFakeStore(map[string]string{"data/a.csv": "a", "data/b.csv": "b"})}
+	store.onGet = func(key string) {
+		if key == "data/b.csv" && !strings.Contains(rec.Body.String(), `"key": "data/a.csv"`) {
+			t.Errorf("data/a.csv had not been sent when data/b.csv was read:\n%s", rec.Body)
+		}
+	}
+	newHandler(newTestRegistry(store), newTemplate()).ServeHTTP(rec, httptest.NewRequest("GET", "/_/api/manifest?prefix=data/&algo=sha256", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("sha256 JSON manifest = %d %v", rec.Code, rec.Header())
+	}
+
+	var m apiManifest
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatalf("parsing JSON manifest: %v\n%s", err, rec.Body)
+	}
+	// Streaming must not change the document writeJSON would have written
+	want := httptest.NewRecorder()
+	if err := writeJSON(want, m); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Body.String() != want.Body.String() {
+		t.Errorf("streamed manifest =\n%s\nwant\n%s", rec.Body, want.Body)
+	}
+	if len(m.Files) != 2 || m.Files[1].SHA256 != fmt.Sprintf("%x", sha256.Sum256([]byte("b"))) {
+		t.Errorf("JSON manifest = %+v", m)
+	}
+}
+
+func TestManifestVerify(t *testing.T) {
+	handler := newHandler(newTestRegistry(newFakeStore(map[string]string{"data/a.csv": "abc"})), newTemplate())
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("abc")))
+
+	for _, c := range []struct {
+		expect string
+		status int
+		match  bool
+	}{
+		{expect: sum, status: http.StatusOK, match: true},
+		{expect: "00" + sum[2:], status: http.StatusConflict},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/_/api/manifest?verify=data/a.csv&algo=sha256&expect="+c.expect, nil))
+		var v apiVerify
+		if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+			t.Fatalf("parsing result: %v\n%s", err, rec.Body)
+		}
+		if rec.Code != c.status || v.Checksum != sum || v.Match == nil || *v.Match != c.match || v.ETagMatch == nil || !*v.ETagMatch || v.Size != 3 {
+			t.Errorf("verify expect=%s: %d %+v", c.expect, rec.Code, v)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/_/manifest?verify=data/a.csv", nil))
+	want := fmt.Sprintf("%x  a.csv\nexpected: not checked\netag: OK\n", md5.Sum([]byte("abc")))
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("text verify = %d %q, want %q", rec.Code, rec.Body, want)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/_/manifest?verify=data/missing.csv", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing object = %d, want 404", rec.Code)
+	}
+}
+
+// kmsStore answers GETs the way S3 does for SSE-KMS objects, whose ETags
+// are not an MD5 of the content
+type kmsStore struct{ *fakeStore }
+
+func (s kmsStore) Get(ctx context.Context, key string, opts GetOptions) (*ObjectResponse, error) {
+	resp, err := s.fakeStore.Get(ctx, key, opts)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	resp.Header.Set("Etag", `"0123456789abcdef0123456789abcdef"`)
+	resp.Header.Set("X-Amz-Server-Side-Encryption", "aws:kms")
+	return resp, nil
+}
+
+func TestManifestVerifyEncrypted(t *testing.T) {
+	handler := newHandler(newTestRegistry(kmsStore{newFakeStore(map[string]string{"data/a.csv": "abc"})}), newTemplate())
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/_/api/manifest?verify=data/a.csv", nil))
+	var v apiVerify
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("parsing result: %v\n%s", err, rec.Body)
+	}
+	if rec.Code != http.StatusOK || !v.OK || !v.Encrypted || v.ETagMatch != nil {
+		t.Errorf("verify = %d %+v, want the ETag left unchecked", rec.Code, v)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/_/manifest?verify=data/a.csv", nil))
+	want := fmt.Sprintf("%x  a.csv\nexpected: not checked\netag: encrypted, not checked\n", md5.Sum([]byte("abc")))
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("text verify = %d %q, want %q", rec.Code, rec.Body, want)
+	}
+}
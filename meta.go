@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userMetaPrefix starts the headers carrying x-amz-meta-* user metadata, in
+// the canonical form net/http gives header names
+const userMetaPrefix = "X-Amz-Meta-"
+
+// defaultStorageClass is the class of objects whose HEAD response has no
+// x-amz-storage-class header
+const defaultStorageClass = "STANDARD"
+
+const metaTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{.Meta.Name}} - {{.Title}}</title>
+    {{template "style"}}
+    {{template "theme"}}
+    <script>
+    function copyToClipboard(text) {
+        navigator.clipboard.writeText(text).then(function() {
+            alert('Copied to clipboard!');
+        }, function() {
+            alert('Failed to copy.');
+        });
+    }
+    </script>
+</head>
+<body>
+    <div class="container">
+        <div class="theme-toggle">
+            <button onclick="toggleTheme()" aria-label="Toggle dark mode">🌓 Theme</button>
+        </div>
+        <h1>{{.Title}}</h1>
+        <div class="breadcrumb" aria-label="Breadcrumb">
+            {{if .HomeURL}}<a href="{{.HomeURL}}">Home</a> /{{end}}
+            {{range $i, $b := .Breadcrumbs}}
+                {{if $i}}/ {{end}}<a href="{{$.BasePath}}{{$b.Path}}">{{$b.Name}}</a>
+            {{end}}
+            / <span class="current">{{.Meta.Name}}</span>
+        </div>
+        <div class="meta-actions">
+            <a href="{{.BasePath}}{{.Meta.Key}}" download class="download-btn">⬇️ Download</a>
+            <button class="copy-btn" onclick="copyToClipboard(new URL('{{.Meta.ProxyPath}}', location.href).href)">🔗 Copy link</button>
+            <button class="copy-btn" onclick="copyToClipboard('{{.Meta.URL}}')">🔗 Copy S3 URL</button>
+            <a href="{{.BasePath}}_/history/{{.Meta.Key}}" class="download-btn">🕘 History</a>
+        </div>
+        <table class="meta" aria-label="Object metadata">
+            <tbody>
+                <tr><th scope="row">Key</th><td><code>{{.Meta.Key}}</code></td></tr>
+                <tr><th scope="row">Size</th><td>{{formatSize .Meta.Size}} ({{.Meta.Size}} bytes)</td></tr>
+                <tr><th scope="row">Last Modified</th><td>{{.Modified}}</td></tr>
+                <tr><th scope="row">ETag</th><td><code>{{.Meta.ETag}}</code></td></tr>
+                <tr><th scope="row">Content-Type</th><td>{{.Meta.ContentType}}</td></tr>
+                {{if .Meta.ContentEncoding}}<tr><th scope="row">Content-Encoding</th><td>{{.Meta.ContentEncoding}}</td></tr>{{end}}
+                {{if .Meta.ContentDisposition}}<tr><th scope="row">Content-Disposition</th><td>{{.Meta.ContentDisposition}}</td></tr>{{end}}
+                <tr><th scope="row">Cache-Control</th><td>{{if .Meta.CacheControl}}{{.Meta.CacheControl}}{{else}}<span class="muted">not set</span>{{end}}</td></tr>
+                <tr><th scope="row">Storage Class</th><td>{{.Meta.StorageClass}}</td></tr>
+                {{if .Meta.VersionID}}<tr><th scope="row">Version</th><td><code>{{.Meta.VersionID}}</code></td></tr>{{end}}
+                <tr><th scope="row">S3 URL</th><td><a href="{{.Meta.URL}}">{{.Meta.URL}}</a></td></tr>
+            </tbody>
+        </table>
+        <h2>User Metadata</h2>
+        {{if .UserMetadata}}
+        <table class="meta" aria-label="User metadata">
+            <tbody>
+                {{range .UserMetadata}}<tr><th scope="row">x-amz-meta-{{.Name}}</th><td>{{.Value}}</td></tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{else}}
+        <p class="notice">This object has no x-amz-meta-* user metadata.</p>
+        {{end}}
+    </div>
+</body>
+</html>`
+
+// objectMeta is what a HEAD request reveals about an object. It is also the
+// JSON form of the metadata page.
+type objectMeta struct {
+	Version            int               `json:"version"`
+	Bucket             string            `json:"bucket"`
+	Key                string            `json:"key"`
+	Name               string            `json:"name"`
+	Size               int64             `json:"size"`
+	LastModified       string            `json:"last_modified,omitempty"` // RFC 3339
+	ETag               string            `json:"etag,omitempty"`          // as sent, with quotes
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	StorageClass       string            `json:"storage_class"`
+	VersionID          string            `json:"version_id,omitempty"`
+	UserMetadata       map[string]string `json:"user_metadata"` // x-amz-meta-* without the prefix
+	URL                string            `json:"url"`           // direct S3 URL
+	ProxyPath          string            `json:"proxy_path"`    // the file through this browser
+}
+
+// metaEntry is one user metadata header, for listing in a stable order
+type metaEntry struct {
+	Name, Value string
+}
+
+// metaPage is the data of the metadata page template
+type metaPage struct {
+	Title, BasePath, HomeURL string
+	Breadcrumbs              []Breadcrumb
+	Meta                     objectMeta
+	Modified                 string
+	UserMetadata             []metaEntry
+}
+
+// newObjectMeta reads the metadata of key from the headers of a HEAD response
+func newObjectMeta(b bucketView, key string, h http.Header) objectMeta {
+	m := objectMeta{
+		Version:            apiVersion,
+		Bucket:             b.ID,
+		Key:                key,
+		Name:               key[strings.LastIndex(key, "/")+1:],
+		ETag:               h.Get("ETag"),
+		ContentType:        h.Get("Content-Type"),
+		ContentEncoding:    h.Get("Content-Encoding"),
+		ContentDisposition: h.Get("Content-Disposition"),
+		CacheControl:       h.Get("Cache-Control"),
+		StorageClass:       h.Get("X-Amz-Storage-Class"),
+		VersionID:          h.Get("X-Amz-Version-Id"),
+		UserMetadata:       map[string]string{},
+		URL:                b.Store.URL(key),
+		ProxyPath:          (&url.URL{Path: b.BasePath + key}).EscapedPath(),
+	}
+	if m.StorageClass == "" {
+		m.StorageClass = defaultStorageClass
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		m.Size = n
+	}
+	if t, err := http.ParseTime(h.Get("Last-Modified")); err == nil {
+		m.LastModified = t.UTC().Format(time.RFC3339)
+	}
+	for name, values := range h {
+		if strings.HasPrefix(name, userMetaPrefix) && len(values) > 0 {
+			m.UserMetadata[strings.ToLower(strings.TrimPrefix(name, userMetaPrefix))] = strings.Join(values, ", ")
+		}
+	}
+	return m
+}
+
+// handleMeta serves /_/meta/<key>, the headers of a HEAD request for key as
+// an HTML page or, when format is JSON, as an objectMeta
+func handleMeta(ctx context.Context, w http.ResponseWriter, b bucketView, key string, limit int, format string, tmpl *template.Template) error {
+	fail := func(status int, err error) error {
+		if format == formatJSON {
+			writeJSONError(w, status, err)
+		} else {
+			writeErrorf(w, status, "%v\n", err)
+		}
+		return err
+	}
+
+	resp, err := b.Store.Head(ctx, key)
+	if err != nil {
+		return fail(http.StatusBadGateway, fmt.Errorf("error fetching from S3: %v", err))
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fail(http.StatusNotFound, fmt.Errorf("object %q not found", key))
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fail(http.StatusBadGateway, fmt.Errorf("S3 returned status %d for %q", resp.StatusCode, key))
+	}
+
+	meta := newObjectMeta(b, key, resp.Header)
+	if format == formatJSON {
+		return writeJSON(w, meta)
+	}
+
+	data := metaPage{
+		Title:       b.Title,
+		BasePath:    b.BasePath,
+		HomeURL:     b.HomeURL,
+		Breadcrumbs: generateBreadcrumbs(b.Title, key[:strings.LastIndex(key, "/")+1], sortOrderAsc, limit),
+		Meta:        meta,
+		Modified:    "unknown",
+	}
+	if t, err := time.Parse(time.RFC3339, meta.LastModified); err == nil {
+		data.Modified = t.Format("2006-01-02 15:04:05")
+	}
+	for name, value := range meta.UserMetadata {
+		data.UserMetadata = append(data.UserMetadata, metaEntry{Name: name, Value: value})
+	}
+	sort.Slice(data.UserMetadata, func(i, j int) bool { return data.UserMetadata[i].Name < data.UserMetadata[j].Name })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.ExecuteTemplate(w, "meta", data); err != nil {
+		fmt.Printf("Error rendering template: %v\n", err)
+		return err
+	}
+	return nil
+}
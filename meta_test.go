@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// headerStore answers HEAD requests with fixed headers
+type headerStore struct {
+	*fakeStore
+	header http.Header
+}
+
+func (s *headerStore) Head(ctx context.Context, key string) (*ObjectResponse, error) {
+	resp, err := s.fakeStore.Head(ctx, key)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	resp.Header = s.header
+	return resp, nil
+}
+
+func TestMetaPage(t *testing.T) {
+	store := &headerStore{
+		fakeStore: newFakeStore(map[string]string{"data/a b.csv": "abc"}),
+		header: http.Header{
+			"Etag":                {`"900150983cd24fb0d6963f7d28e17f72"`},
+			"Content-Type":        {"text/csv"},
+			"Content-Length":      {"3"},
+			"Cache-Control":       {"max-age=60"},
+			"Last-Modified":       {"Tue, 02 Jan 2024 03:04:05 GMT"},
+			"X-Amz-Storage-Class": {"STANDARD_IA"},
+			"X-Amz-Meta-Station":  {"WEL"},
+		},
+	}
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/_/meta/data/a%20b.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", resp.StatusCode, body)
+	}
+	for _, want := range []string{
+		"900150983cd24fb0d6963f7d28e17f72", "max-age=60", "STANDARD_IA",
+		"x-amz-meta-station", "WEL", "2024-01-02 03:04:05", `href="/data/a%20b.csv" download`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("page does not contain %q", want)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/_/meta/data/a%20b.csv", nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m objectMeta
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if m.Key != "data/a b.csv" || m.Size != 3 || m.LastModified != "2024-01-02T03:04:05Z" ||
+		m.StorageClass != "STANDARD_IA" || m.UserMetadata["station"] != "WEL" ||
+		m.URL != "https://fake.example/data/a b.csv" || m.ProxyPath != "/data/a%20b.csv" {
+		t.Errorf("metadata = %+v", m)
+	}
+
+	resp, err = http.Get(srv.URL + "/_/api/meta/data/missing.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing object status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestMetaDefaultsStorageClass(t *testing.T) {
+	b := bucketView{Bucket: &Bucket{ID: "test", Store: newFakeStore(nil)}, BasePath: "/b/test/"}
+	m := newObjectMeta(b, "a.csv", http.Header{})
+	if m.StorageClass != defaultStorageClass || m.ProxyPath != "/b/test/a.csv" || len(m.UserMetadata) != 0 {
+		t.Errorf("metadata = %+v", m)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ObjectStore is the storage backend consumed by the browser UI and the file
+// proxy. Implementations must be safe to reuse across requests.
+type ObjectStore interface {
+	// List returns a single page of objects and common prefixes.
+	List(ctx context.Context, opts ListOptions) (*ListPage, error)
+
+	// Head returns the status and headers for a single object. The Body of
+	// the returned response is always empty.
+	Head(ctx context.Context, key string) (*ObjectResponse, error)
+
+	// Get fetches a single object. Non-2xx responses from the origin are
+	// returned as-is so they can be relayed to the client; only transport
+	// failures are reported as errors.
+	Get(ctx context.Context, key string, opts GetOptions) (*ObjectResponse, error)
+
+	// URL returns the direct origin URL of key.
+	URL(key string) string
+}
+
+// ListOptions controls a single List call
+type ListOptions struct {
+	Prefix     string
+	Delimiter  string
+	Token      string // NextToken from the previous page, empty for the first page
+	StartAfter string // only list keys after this one; ignored when Token is set
+	MaxKeys    int    // page size hint, 0 for the store's default
+}
+
+// ListPage is one page of results returned by ObjectStore.List
+type ListPage struct {
+	CommonPrefixes []string
+	Objects        []ObjectInfo
+	NextToken      string // opaque continuation token, empty when there are no more pages
+}
+
+// ObjectInfo describes a single stored object
+type ObjectInfo struct {
+	Key          string
+	LastModified time.Time
+	Size         int64
+	ETag         string // as listed, with quotes; may be empty
+}
+
+// GetOptions controls a single Get call
+type GetOptions struct {
+	Range     string // value of the HTTP Range header, if any
+	VersionID string // fetch this version rather than the latest
+}
+
+// ObjectResponse is the origin response for a Head or Get call
+type ObjectResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeStore is an in-memory ObjectStore used by the tests. List returns at
+// most pageSize entries per call so pagination paths are exercised.
+type fakeStore struct {
+	objects  map[string]string
+	modified time.Time
+	times    map[string]time.Time // overrides modified for some keys
+	pageSize int
+}
+
+func newFakeStore(objects map[string]string) *fakeStore {
+	return &fakeStore{
+		objects:  objects,
+		modified: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		pageSize: 1000,
+	}
+}
+
+func (f *fakeStore) List(_ context.Context, opts ListOptions) (*ListPage, error) {
+	keys := make([]string, 0, len(f.objects))
+	for k := range f.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Tokens are the last key or prefix returned, like S3's V1 markers
+	after := opts.Token
+	if after == "" {
+		after = opts.StartAfter
+	}
+	pageSize := f.pageSize
+	if opts.MaxKeys > 0 && opts.MaxKeys < pageSize {
+		pageSize = opts.MaxKeys
+	}
+
+	page := &ListPage{}
+	seen := map[string]bool{}
+	count := 0
+	for _, k := range keys {
+		if !strings.HasPrefix(k, opts.Prefix) || k <= after {
+			continue
+		}
+		entry := k
+		isPrefix := false
+		if opts.Delimiter != "" {
+			if i := strings.Index(k[len(opts.Prefix):], opts.Delimiter); i >= 0 {
+				entry = k[:len(opts.Prefix)+i+len(opts.Delimiter)]
+				isPrefix = true
+			}
+		}
+		if seen[entry] || (isPrefix && entry <= after) {
+			continue
+		}
+		if count == pageSize {
+			page.NextToken = lastEntry(page)
+			break
+		}
+		seen[entry] = true
+		count++
+		if isPrefix {
+			page.CommonPrefixes = append(page.CommonPrefixes, entry)
+		} else {
+			page.Objects = append(page.Objects, ObjectInfo{
+				Key:          k,
+				LastModified: f.modTime(k),
+				Size:         int64(len(f.objects[k])),
+				ETag:         fakeETag(f.objects[k]),
+			})
+		}
+	}
+	return page, nil
+}
+
+func (f *fakeStore) modTime(key string) time.Time {
+	if t, ok := f.times[key]; ok {
+		return t
+	}
+	return f.modified
+}
+
+// fakeETag is the ETag S3 gives a single-part upload of body
+func fakeETag(body string) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum([]byte(body)))
+}
+
+func lastEntry(page *ListPage) string {
+	last := ""
+	if n := len(page.Objects); n > 0 {
+		last = page.Objects[n-1].Key
+	}
+	if n := len(page.CommonPrefixes); n > 0 && page.CommonPrefixes[n-1] > last {
+		last = page.CommonPrefixes[n-1]
+	}
+	return last
+}
+
+func (f *fakeStore) Head(ctx context.Context, key string) (*ObjectResponse, error) {
+	resp, err := f.Get(ctx, key, GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = http.NoBody
+	return resp, nil
+}
+
+func (f *fakeStore) Get(_ context.Context, key string, _ GetOptions) (*ObjectResponse, error) {
+	body, ok := f.objects[key]
+	if !ok {
+		return &ObjectResponse{
+			StatusCode: http.StatusNotFound,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("NoSuchKey")),
+		}, nil
+	}
+	return &ObjectResponse{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Content-Type":   {"text/plain"},
+			"Content-Length": {strconv.Itoa(len(body))},
+			"Etag":           {fakeETag(body)},
+		},
+		Body: io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func (f *fakeStore) URL(key string) string {
+	return "https://fake.example/" + key
+}
+
+func TestListObjectsFollowsPages(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/a.csv":       "a",
+		"data/b.csv":       "bb",
+		"data/sub/c.csv":   "ccc",
+		"data/sub2/d.csv":  "dddd",
+		"data/z.json":      "z",
+		"other/ignore.txt": "x",
+	})
+	store.pageSize = 2
+
+	objects, _, err := listObjects(context.Background(), store, "data", 0)
+	if err != nil {
+		t.Fatalf("listObjects: %v", err)
+	}
+
+	var got []string
+	for _, o := range objects {
+		got = append(got, o.Key)
+	}
+	want := []string{"data/a.csv", "data/b.csv", "data/sub/", "data/sub2/", "data/z.json"}
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("listObjects keys = %v, want %v", got, want)
+	}
+}
+
+// countingStore records how many List calls reach the wrapped store
+type countingStore struct {
+	ObjectStore
+	lists int
+}
+
+func (c *countingStore) List(ctx context.Context, opts ListOptions) (*ListPage, error) {
+	c.lists++
+	return c.ObjectStore.List(ctx, opts)
+}
+
+func TestListObjectsPageFetchesOnlyNeededPages(t *testing.T) {
+	objects := map[string]string{}
+	for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		objects["data/"+k+".csv"] = k
+	}
+	objects["data/cc/x.csv"] = "x"
+	fake := newFakeStore(objects)
+	fake.pageSize = 2
+	store := &countingStore{ObjectStore: fake}
+
+	got, more, err := listObjectsPage(context.Background(), store, "data", "", 3, 100)
+	if err != nil {
+		t.Fatalf("listObjectsPage: %v", err)
+	}
+	if keys := keysOf(got); keys != "data/a.csv,data/b.csv,data/c.csv" || !more {
+		t.Errorf("first page = %v, more %v", keys, more)
+	}
+	if store.lists != 2 {
+		t.Errorf("List calls = %d, want 2", store.lists)
+	}
+
+	got, more, err = listObjectsPage(context.Background(), store, "data", "data/c.csv", 3, 100)
+	if err != nil {
+		t.Fatalf("listObjectsPage: %v", err)
+	}
+	if keys := keysOf(got); keys != "data/cc/,data/d.csv,data/e.csv" || !more {
+		t.Errorf("second page = %v, more %v", keys, more)
+	}
+
+	got, more, err = listObjectsPage(context.Background(), store, "data", "data/g.csv", 3, 100)
+	if err != nil {
+		t.Fatalf("listObjectsPage: %v", err)
+	}
+	if keys := keysOf(got); keys != "data/h.csv" || more {
+		t.Errorf("last page = %v, more %v", keys, more)
+	}
+
+	got, more, err = listObjectsPage(context.Background(), store, "data", "", 100000, 2)
+	if err != nil {
+		t.Fatalf("listObjectsPage: %v", err)
+	}
+	if keys := keysOf(got); keys != "data/a.csv,data/b.csv" || !more {
+		t.Errorf("page above maxItems = %v, more %v", keys, more)
+	}
+}
+
+func TestListObjectsStopsAtMaxItems(t *testing.T) {
+	fake := newFakeStore(map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"})
+	fake.pageSize = 2
+	store := &countingStore{ObjectStore: fake}
+
+	objects, truncated, err := listObjects(context.Background(), store, "", 3)
+	if err != nil {
+		t.Fatalf("listObjects: %v", err)
+	}
+	if len(objects) != 3 || !truncated || store.lists != 2 {
+		t.Errorf("listObjects = %d objects, truncated %v after %d calls", len(objects), truncated, store.lists)
+	}
+}
@@ -3,29 +3,31 @@ package main
 import (
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	neturl "net/url"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/fastly/compute-sdk-go/fsthttp"
 )
 
-const (
-	bucketName = "geonet-open-data"
-	region     = "ap-southeast-2"
-	bucketURL  = "https://geonet-open-data.s3-ap-southeast-2.amazonaws.com"
-)
+// maxListKeys is the largest page size S3 returns for a single List call
+const maxListKeys = 1000
 
-// ListBucketResult represents the XML response from S3 ListObjects API
+// ListBucketResult represents the XML response from the S3 ListObjects and
+// ListObjectsV2 APIs
 type ListBucketResult struct {
-	XMLName        xml.Name       `xml:"ListBucketResult"`
-	CommonPrefixes []CommonPrefix `xml:"CommonPrefixes"`
-	Contents       []Object       `xml:"Contents"`
-	IsTruncated    bool           `xml:"IsTruncated"`
-	NextMarker     string         `xml:"NextMarker"`
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	CommonPrefixes        []CommonPrefix `xml:"CommonPrefixes"`
+	Contents              []Object       `xml:"Contents"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	NextMarker            string         `xml:"NextMarker"`
+	KeyCount              int            `xml:"KeyCount"`
+	NextContinuationToken string         `xml:"NextContinuationToken"`
 }
 
 // CommonPrefix represents a directory prefix in the S3 bucket
@@ -38,53 +40,66 @@ type Object struct {
 	Key          string    `xml:"Key"`
 	LastModified time.Time `xml:"LastModified"`
 	Size         int64     `xml:"Size"`
+	ETag         string    `xml:"ETag"`
 }
 
-func listObjects(prefix string) ([]S3Object, error) {
-	// Ensure prefix ends with / if it's not empty
-	if prefix != "" && !strings.HasSuffix(prefix, "/") {
-		prefix += "/"
-	}
-
-	var allObjects []S3Object
-	marker := ""
-
-	for {
-		objects, nextMarker, err := fetchObjectsPage(prefix, marker)
-		if err != nil {
-			return nil, err
-		}
-		allObjects = append(allObjects, objects...)
-
-		if nextMarker == "" {
-			break
-		}
-		marker = nextMarker
-	}
+// s3Store is an ObjectStore backed by an S3 bucket, either publicly readable
+// or private with SigV4-signed requests. On Fastly Compute the client's
+// transport routes requests to a named backend; in standalone mode it is a
+// regular net/http client.
+type s3Store struct {
+	client    *http.Client
+	bucketURL string
+	listV1    bool         // use the legacy ListObjects API for stores without ListObjectsV2
+	signer    *sigV4Signer // nil for anonymous access
+}
 
-	return allObjects, nil
+func newS3Store(client *http.Client, bucketURL string) *s3Store {
+	return &s3Store{client: client, bucketURL: strings.TrimSuffix(bucketURL, "/")}
 }
 
-func fetchObjectsPage(prefix, marker string) ([]S3Object, string, error) {
+// List implements ObjectStore using the S3 ListObjectsV2 API, or ListObjects
+// when listV1 is set. For V1 the continuation token is the marker.
+func (s *s3Store) List(ctx context.Context, opts ListOptions) (*ListPage, error) {
 	// Construct the URL for listing objects
-	url := fmt.Sprintf("%s/?prefix=%s&delimiter=/", bucketURL, neturl.QueryEscape(prefix))
-	if marker != "" {
-		url += fmt.Sprintf("&marker=%s", neturl.QueryEscape(marker))
+	q := neturl.Values{}
+	q.Set("prefix", opts.Prefix)
+	if opts.Delimiter != "" {
+		q.Set("delimiter", opts.Delimiter)
+	}
+	if opts.MaxKeys > 0 {
+		q.Set("max-keys", strconv.Itoa(opts.MaxKeys))
+	}
+	switch {
+	case s.listV1 && opts.Token != "":
+		q.Set("marker", opts.Token)
+	case s.listV1 && opts.StartAfter != "":
+		q.Set("marker", opts.StartAfter)
+	case s.listV1:
+	case opts.Token != "":
+		q.Set("list-type", "2")
+		q.Set("continuation-token", opts.Token)
+	case opts.StartAfter != "":
+		q.Set("list-type", "2")
+		q.Set("start-after", opts.StartAfter)
+	default:
+		q.Set("list-type", "2")
 	}
+	url := s.bucketURL + "/?" + q.Encode()
 
 	// Create a new request
-	req, err := fsthttp.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	// Add required headers for S3
 	req.Header.Set("Accept", "application/xml")
 
 	// Send the request
-	resp, err := req.Send(context.Background(), "TheOrigin")
+	resp, err := s.do(req)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to make HTTP request: %v", err)
+		return nil, fmt.Errorf("failed to make HTTP request: %v", err)
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
@@ -92,32 +107,203 @@ func fetchObjectsPage(prefix, marker string) ([]S3Object, string, error) {
 		}
 	}()
 
-	if resp.StatusCode != fsthttp.StatusOK {
+	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, "", fmt.Errorf("HTTP request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("HTTP request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	// Parse the XML response
 	var result ListBucketResult
 	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, "", fmt.Errorf("failed to parse XML response: %v", err)
+		return nil, fmt.Errorf("failed to parse XML response: %v", err)
+	}
+
+	page := &ListPage{
+		CommonPrefixes: make([]string, 0, len(result.CommonPrefixes)),
+		Objects:        make([]ObjectInfo, 0, len(result.Contents)),
+	}
+	if s.listV1 {
+		page.NextToken = getNextMarker(result)
+	} else if result.IsTruncated {
+		if result.NextContinuationToken == "" {
+			return nil, fmt.Errorf("truncated ListObjectsV2 response without a continuation token; set list_api=v1 for this store")
+		}
+		page.NextToken = result.NextContinuationToken
+	}
+	for _, cp := range result.CommonPrefixes {
+		page.CommonPrefixes = append(page.CommonPrefixes, cp.Prefix)
+	}
+	for _, object := range result.Contents {
+		page.Objects = append(page.Objects, ObjectInfo{
+			Key:          object.Key,
+			LastModified: object.LastModified,
+			Size:         object.Size,
+			ETag:         object.ETag,
+		})
+	}
+	return page, nil
+}
+
+// Head implements ObjectStore
+func (s *s3Store) Head(ctx context.Context, key string) (*ObjectResponse, error) {
+	resp, err := s.send(ctx, "HEAD", key, GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.Body.Close(); err != nil {
+		fmt.Printf("Error closing response body: %v\n", err)
+	}
+	resp.Body = http.NoBody
+	return resp, nil
+}
+
+// Get implements ObjectStore
+func (s *s3Store) Get(ctx context.Context, key string, opts GetOptions) (*ObjectResponse, error) {
+	return s.send(ctx, "GET", key, opts)
+}
+
+// URL implements ObjectStore
+func (s *s3Store) URL(key string) string {
+	return s.bucketURL + "/" + awsURIEncode(key, false)
+}
+
+// do signs req when credentials are configured and sends it
+func (s *s3Store) do(req *http.Request) (*http.Response, error) {
+	if s.signer != nil {
+		s.signer.Sign(req)
+	}
+	return s.client.Do(req)
+}
+
+func (s *s3Store) send(ctx context.Context, method, key string, opts GetOptions) (*ObjectResponse, error) {
+	url := s.URL(key)
+	if opts.VersionID != "" {
+		url += "?versionId=" + neturl.QueryEscape(opts.VersionID)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if opts.Range != "" {
+		req.Header.Set("Range", opts.Range)
 	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make HTTP request: %v", err)
+	}
+	return &ObjectResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       resp.Body,
+	}, nil
+}
 
-	// Process the response
-	objects := processObjects(result, prefix)
+// listObjects lists every folder and file directly under prefix. When
+// maxItems is positive, listing stops once that many entries have been
+// collected and truncated is set.
+func listObjects(ctx context.Context, store ObjectStore, prefix string, maxItems int) (objects []S3Object, truncated bool, err error) {
+	// Ensure prefix ends with / if it's not empty
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
 
-	// Determine next marker
-	nextMarker := getNextMarker(result)
+	var allObjects []S3Object
+	token := ""
+
+	for {
+		page, err := store.List(ctx, ListOptions{Prefix: prefix, Delimiter: "/", Token: token})
+		if err != nil {
+			return nil, false, err
+		}
+		allObjects = append(allObjects, processObjects(page, prefix)...)
 
-	return objects, nextMarker, nil
+		if page.NextToken == "" {
+			break
+		}
+		if maxItems > 0 && len(allObjects) >= maxItems {
+			return allObjects[:maxItems], true, nil
+		}
+		token = page.NextToken
+	}
+
+	if maxItems > 0 && len(allObjects) > maxItems {
+		return allObjects[:maxItems], true, nil
+	}
+	return allObjects, false, nil
 }
 
-func processObjects(result ListBucketResult, prefix string) []S3Object {
-	objects := make([]S3Object, 0, len(result.CommonPrefixes)+len(result.Contents))
+// listObjectsPage lists up to limit folders and files directly under prefix
+// whose keys sort after startAfter, in key order. Only as many store pages as
+// needed are fetched, and never more than maxItems entries whatever the
+// limit. more reports whether further entries follow.
+func listObjectsPage(ctx context.Context, store ObjectStore, prefix, startAfter string, limit, maxItems int) (objects []S3Object, more bool, err error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	limit = max(min(limit, maxItems), 1)
+
+	token := ""
+	for {
+		// Ask for one entry more than needed to learn whether a next page exists
+		want := limit + 1 - len(objects)
+		if want > maxListKeys {
+			want = maxListKeys
+		}
+		page, err := store.List(ctx, ListOptions{Prefix: prefix, Delimiter: "/", Token: token, StartAfter: startAfter, MaxKeys: want})
+		if err != nil {
+			return nil, false, err
+		}
+		entries := processObjects(page, prefix)
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+		for _, e := range entries {
+			// Some stores repeat a common prefix that equals start-after
+			if e.Key > startAfter {
+				objects = append(objects, e)
+			}
+		}
+
+		if len(objects) > limit {
+			return objects[:limit], true, nil
+		}
+		if page.NextToken == "" {
+			return objects, false, nil
+		}
+		token = page.NextToken
+	}
+}
+
+// errStopWalk ends walkObjects early without an error
+var errStopWalk = errors.New("stop walk")
+
+// walkObjects lists every object under prefix recursively (without a
+// delimiter) in key order, starting after startAfter. fn is called with the
+// objects of each store page as it arrives, so nothing is buffered; it may
+// return errStopWalk to end the walk.
+func walkObjects(ctx context.Context, store ObjectStore, prefix, startAfter string, fn func([]ObjectInfo) error) error {
+	token := ""
+	for {
+		page, err := store.List(ctx, ListOptions{Prefix: prefix, Token: token, StartAfter: startAfter})
+		if err != nil {
+			return err
+		}
+		if err := fn(page.Objects); err != nil {
+			if errors.Is(err, errStopWalk) {
+				return nil
+			}
+			return err
+		}
+		if page.NextToken == "" {
+			return nil
+		}
+		token = page.NextToken
+	}
+}
+
+func processObjects(page *ListPage, prefix string) []S3Object {
+	objects := make([]S3Object, 0, len(page.CommonPrefixes)+len(page.Objects))
 
 	// Add common prefixes (directories)
-	for _, cp := range result.CommonPrefixes {
-		key := cp.Prefix
+	for _, key := range page.CommonPrefixes {
 		name := path.Base(strings.TrimSuffix(key, "/"))
 		href := path.Join(prefix, name) + "/"
 		objects = append(objects, S3Object{
@@ -129,7 +315,7 @@ func processObjects(result ListBucketResult, prefix string) []S3Object {
 	}
 
 	// Add objects (files)
-	for _, object := range result.Contents {
+	for _, object := range page.Objects {
 		key := object.Key
 		// Skip the current directory marker (object with key == prefix)
 		if prefix != "" && key == prefix {
@@ -143,6 +329,7 @@ func processObjects(result ListBucketResult, prefix string) []S3Object {
 			Key:          key,
 			Name:         path.Base(key),
 			LastModified: object.LastModified.Format("2006-01-02 15:04:05"),
+			ModTime:      object.LastModified,
 			Size:         object.Size,
 			IsDirectory:  false,
 		})
@@ -151,19 +338,25 @@ func processObjects(result ListBucketResult, prefix string) []S3Object {
 	return objects
 }
 
+// getNextMarker returns the marker for the next ListObjects (V1) page. S3
+// only returns NextMarker when a delimiter is used; otherwise the marker is
+// the lexically last key or common prefix of the page.
 func getNextMarker(result ListBucketResult) string {
 	if !result.IsTruncated {
 		return ""
 	}
+	if result.NextMarker != "" {
+		return result.NextMarker
+	}
 
-	switch {
-	case len(result.Contents) > 0:
-		return result.Contents[len(result.Contents)-1].Key
-	case len(result.CommonPrefixes) > 0:
-		return result.CommonPrefixes[len(result.CommonPrefixes)-1].Prefix
-	default:
-		return ""
+	last := ""
+	if n := len(result.Contents); n > 0 {
+		last = result.Contents[n-1].Key
+	}
+	if n := len(result.CommonPrefixes); n > 0 && result.CommonPrefixes[n-1].Prefix > last {
+		last = result.CommonPrefixes[n-1].Prefix
 	}
+	return last
 }
 
 func formatSize(size int64) string {
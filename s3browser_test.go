@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// listPages serves canned ListBucketResult pages keyed by the continuation
+// token (V2) or marker (V1) of the request
+func listPages(t *testing.T, v2 bool, pages map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		token := q.Get("marker")
+		if v2 {
+			if q.Get("list-type") != "2" {
+				t.Errorf("list-type = %q, want 2", q.Get("list-type"))
+			}
+			token = q.Get("continuation-token")
+		} else if q.Has("list-type") {
+			t.Errorf("V1 request sent list-type=%q", q.Get("list-type"))
+		}
+		body, ok := pages[token]
+		if !ok {
+			t.Errorf("unexpected token %q", token)
+			http.Error(w, "bad token", http.StatusBadRequest)
+			return
+		}
+		if _, err := io.WriteString(w, `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`+body+`</ListBucketResult>`); err != nil {
+			t.Errorf("write: %v", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func keysOf(objects []S3Object) string {
+	keys := make([]string, 0, len(objects))
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestListObjectsV2PrefixOnlyPages(t *testing.T) {
+	srv := listPages(t, true, map[string]string{
+		"": `<KeyCount>2</KeyCount><IsTruncated>true</IsTruncated><NextContinuationToken>tok-1</NextContinuationToken>
+			<CommonPrefixes><Prefix>a/</Prefix></CommonPrefixes><CommonPrefixes><Prefix>b/</Prefix></CommonPrefixes>`,
+		"tok-1": `<KeyCount>1</KeyCount><IsTruncated>true</IsTruncated><NextContinuationToken>tok-2</NextContinuationToken>
+			<CommonPrefixes><Prefix>c/</Prefix></CommonPrefixes>`,
+		"tok-2": `<KeyCount>1</KeyCount><IsTruncated>false</IsTruncated>
+			<Contents><Key>d.txt</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>1</Size></Contents>`,
+	})
+
+	objects, _, err := listObjects(context.Background(), newS3Store(srv.Client(), srv.URL), "", 0)
+	if err != nil {
+		t.Fatalf("listObjects: %v", err)
+	}
+	if got, want := keysOf(objects), "a/,b/,c/,d.txt"; got != want {
+		t.Errorf("keys = %q, want %q", got, want)
+	}
+}
+
+func TestListObjectsV2TruncatedWithoutToken(t *testing.T) {
+	srv := listPages(t, true, map[string]string{
+		"": `<IsTruncated>true</IsTruncated><CommonPrefixes><Prefix>a/</Prefix></CommonPrefixes>`,
+	})
+	_, _, err := listObjects(context.Background(), newS3Store(srv.Client(), srv.URL), "", 0)
+	if err == nil || !strings.Contains(err.Error(), "list_api=v1") {
+		t.Errorf("listObjects error = %v, want hint about list_api=v1", err)
+	}
+}
+
+func TestListObjectsV1Markers(t *testing.T) {
+	srv := listPages(t, false, map[string]string{
+		// Prefix-only page without NextMarker: the last prefix is the marker
+		"": `<IsTruncated>true</IsTruncated>
+			<CommonPrefixes><Prefix>a/</Prefix></CommonPrefixes><CommonPrefixes><Prefix>b/</Prefix></CommonPrefixes>`,
+		// A common prefix sorting after the last key must win over the key
+		"b/": `<IsTruncated>true</IsTruncated>
+			<Contents><Key>c.txt</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>1</Size></Contents>
+			<CommonPrefixes><Prefix>d/</Prefix></CommonPrefixes>`,
+		// An explicit NextMarker is used as-is
+		"d/": `<IsTruncated>true</IsTruncated><NextMarker>e/</NextMarker>
+			<CommonPrefixes><Prefix>e/</Prefix></CommonPrefixes>`,
+		"e/": `<IsTruncated>false</IsTruncated>
+			<Contents><Key>f.txt</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>1</Size></Contents>`,
+	})
+
+	store := newS3Store(srv.Client(), srv.URL)
+	store.listV1 = true
+	objects, _, err := listObjects(context.Background(), store, "", 0)
+	if err != nil {
+		t.Fatalf("listObjects: %v", err)
+	}
+	if got, want := keysOf(objects), "a/,b/,d/,c.txt,e/,f.txt"; got != want {
+		t.Errorf("keys = %q, want %q", got, want)
+	}
+}
+
+// newMinIOStandIn starts a path-style S3-compatible server for bucket "data"
+// holding a single object
+func newMinIOStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/data/":
+			if r.URL.Query().Get("prefix") != "dir/" {
+				t.Errorf("prefix = %q, want dir/", r.URL.Query().Get("prefix"))
+			}
+			if _, err := io.WriteString(w, `<ListBucketResult><Name>data</Name><KeyCount>1</KeyCount><IsTruncated>false</IsTruncated>
+				<Contents><Key>dir/file one.txt</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>5</Size></Contents>
+				</ListBucketResult>`); err != nil {
+				t.Errorf("write: %v", err)
+			}
+		case "/data/dir/file%20one.txt":
+			if _, err := io.WriteString(w, "hello"); err != nil {
+				t.Errorf("write: %v", err)
+			}
+		default:
+			t.Errorf("unexpected request path %q", r.URL.EscapedPath())
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPathStyleEndpoint(t *testing.T) {
+	srv := newMinIOStandIn(t)
+	cfg, err := loadConfig(mapLookup(map[string]string{
+		"bucket":     "data",
+		"endpoint":   srv.URL,
+		"path_style": "true",
+	}), mapLookup(nil))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	reg := newBucketRegistryFromConfig(cfg, func(BucketConfig) *http.Client { return srv.Client() }, nil)
+	h := newHandler(reg, newTemplate())
+
+	if got, want := reg.Buckets[0].Store.URL("dir/file one.txt"), srv.URL+"/data/dir/file%20one.txt"; got != want {
+		t.Errorf("URL = %q, want %q", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/?prefix=dir/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "file one.txt") {
+		t.Errorf("listing = %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/dir/file%20one.txt", nil))
+	if w.Body.String() != "hello" {
+		t.Errorf("file proxy = %d %q, want %q", w.Code, w.Body.String(), "hello")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Search budgets: a search request stops after scanning this long or the
+// bucket's MaxListItems keys, and offers to continue where it stopped
+const searchTimeBudget = 10 * time.Second
+
+// maxSearchQuery bounds the length of a search query
+const maxSearchQuery = 1024
+
+// Search modes
+const (
+	searchSubstring = "substring"
+	searchGlob      = "glob"
+	searchRegex     = "regex"
+)
+
+const searchTemplate = `{{define "search_head"}}<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Search{{if .Query}}: {{.Query}}{{end}} - {{.Title}}</title>
+    {{template "style"}}
+    {{template "theme"}}
+    <script>
+    function copyToClipboard(text) {
+        navigator.clipboard.writeText(text).then(function() {
+            alert('Copied to clipboard!');
+        }, function() {
+            alert('Failed to copy.');
+        });
+    }
+    </script>
+</head>
+<body>
+    <div class="container">
+        <div class="theme-toggle">
+            <button onclick="toggleTheme()" aria-label="Toggle dark mode">🌓 Theme</button>
+        </div>
+        <h1>{{.Title}}</h1>
+        <div class="breadcrumb" aria-label="Breadcrumb">
+            {{if .HomeURL}}<a href="{{.HomeURL}}">Home</a> /{{end}}
+            {{range $i, $b := .Breadcrumbs}}
+                {{if $i}}/ {{end}}<a href="{{$.BasePath}}{{$b.Path}}">{{$b.Name}}</a>
+            {{end}}
+            / <span class="current">Search</span>
+        </div>
+        {{template "search_form" .}}
+        {{if .Error}}<p class="notice" role="alert">{{.Error}}</p>{{end}}
+        {{if .Searched}}
+        <table aria-label="Search results">
+            <thead>
+                <tr>
+                    <th>Name</th>
+                    <th class="date">Last Modified</th>
+                    <th class="size">Size</th>
+                    <th>Actions</th>
+                </tr>
+            </thead>
+            <tbody>
+        {{end}}
+{{end}}
+{{define "search_foot"}}
+        {{if .Searched}}
+                {{if eq .Hits 0}}
+                <tr>
+                    <td colspan="4" style="text-align:center; color:#888;">No matches{{if .NextAfter}} yet{{end}}.</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{if .Error}}<p class="notice" role="alert">{{.Error}}</p>{{end}}
+        <p class="notice">Scanned {{.Scanned}} keys{{if .StartAfter}} after {{.StartAfter}}{{end}}.{{if .BudgetSpent}} The search stopped before reaching the end of the folder.{{end}}</p>
+        {{if .NextAfter}}
+        <div class="pagination" aria-label="Pagination">
+            <a href="?prefix={{.Prefix}}&q={{.Query}}&mode={{.Mode}}&limit={{.Limit}}&after={{.NextAfter}}">{{if .BudgetSpent}}Continue searching{{else}}Next ➡️{{end}}</a>
+        </div>
+        {{end}}
+        {{end}}
+    </div>
+</body>
+</html>
+{{end}}`
+
+// searchPage is the data of the search page templates
+type searchPage struct {
+	Title, BasePath, HomeURL string
+	Breadcrumbs              []Breadcrumb
+	Prefix, Query, Mode      string
+	Limit                    int
+	Error                    string
+
+	// Set once the search has run, for the footer
+	Searched    bool
+	StartAfter  string // where this page of the search started
+	Hits        int
+	Scanned     int
+	NextAfter   string // resume point when the search stopped early
+	BudgetSpent bool   // stopped by the time or key budget rather than the limit
+}
+
+// newSearchForm is the "searchForm" template function for the search box of
+// the browser page
+func newSearchForm(basePath, prefix string) searchPage {
+	return searchPage{BasePath: basePath, Prefix: prefix}
+}
+
+// newKeyMatcher compiles a search query. Keys are matched relative to the
+// searched prefix. Globs without a slash match the file name; the empty mode
+// picks glob when the query has wildcards and substring otherwise.
+func newKeyMatcher(query, mode string) (func(rel string) bool, error) {
+	if len(query) > maxSearchQuery {
+		return nil, fmt.Errorf("search query is longer than %d characters", maxSearchQuery)
+	}
+	if mode == "" {
+		mode = searchSubstring
+		if strings.ContainsAny(query, "*?[") {
+			mode = searchGlob
+		}
+	}
+	switch mode {
+	case searchSubstring:
+		lower := strings.ToLower(query)
+		return func(rel string) bool {
+			return strings.Contains(strings.ToLower(rel), lower)
+		}, nil
+	case searchGlob:
+		if _, err := path.Match(query, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %v", query, err)
+		}
+		byName := !strings.Contains(query, "/")
+		return func(rel string) bool {
+			if byName {
+				rel = path.Base(rel)
+			}
+			ok, _ := path.Match(query, rel)
+			return ok
+		}, nil
+	case searchRegex:
+		re, err := regexp.Compile(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %v", err)
+		}
+		return re.MatchString, nil
+	}
+	return nil, fmt.Errorf("unknown search mode %q: want substring, glob or regex", mode)
+}
+
+// handleSearch serves /_/search, walking the keys under prefix recursively
+// and streaming matching files into the results table as S3 pages arrive. A
+// page ends after limit hits or when the search budget is spent, with a link
+// that resumes after the last key looked at.
+func handleSearch(ctx context.Context, w http.ResponseWriter, b bucketView, prefix, query, mode, startAfter string, limit int, tmpl *template.Template) error {
+	data := &searchPage{
+		Title:       b.Title,
+		BasePath:    b.BasePath,
+		HomeURL:     b.HomeURL,
+		Breadcrumbs: generateBreadcrumbs(b.Title, prefix, sortOrderAsc, limit),
+		Prefix:      prefix,
+		Query:       query,
+		Mode:        mode,
+		Limit:       limit,
+		StartAfter:  startAfter,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	var match func(string) bool
+	if query != "" {
+		var err error
+		if match, err = newKeyMatcher(query, mode); err != nil {
+			data.Error = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+	data.Searched = match != nil
+	if err := tmpl.ExecuteTemplate(w, "search_head", data); err != nil {
+		fmt.Printf("Error rendering template: %v\n", err)
+		return err
+	}
+	if match == nil {
+		return executeSearchFoot(w, data, tmpl)
+	}
+
+	flusher, _ := w.(http.Flusher)
+	deadline := time.Now().Add(searchTimeBudget)
+	maxScanned := b.maxListItems()
+	last := startAfter
+	walkPrefix := prefix
+	if walkPrefix != "" && !strings.HasSuffix(walkPrefix, "/") {
+		walkPrefix += "/"
+	}
+
+	err := walkObjects(ctx, b.Store, walkPrefix, startAfter, func(objects []ObjectInfo) error {
+		for _, o := range objects {
+			if data.Hits == limit {
+				data.NextAfter = last
+				return errStopWalk
+			}
+			if data.Scanned == maxScanned {
+				data.NextAfter, data.BudgetSpent = last, true
+				return errStopWalk
+			}
+			data.Scanned++
+			last = o.Key
+			rel := strings.TrimPrefix(o.Key, walkPrefix)
+			if strings.HasSuffix(o.Key, "/") || !match(rel) {
+				continue
+			}
+			data.Hits++
+			if err := writeSearchHit(w, b, o, limit, tmpl); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if time.Now().After(deadline) {
+			data.NextAfter, data.BudgetSpent = last, true
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil {
+		data.Error = fmt.Sprintf("Error listing objects: %v", err)
+	}
+	return executeSearchFoot(w, data, tmpl)
+}
+
+// writeSearchHit renders one matching file as a table row
+func writeSearchHit(w http.ResponseWriter, b bucketView, o ObjectInfo, limit int, tmpl *template.Template) error {
+	folder := ""
+	if i := strings.LastIndex(o.Key, "/"); i >= 0 {
+		folder = o.Key[:i+1]
+	}
+	items := processObjects(&ListPage{Objects: []ObjectInfo{o}}, "")
+	addFileMetadata(items, b.Store)
+	row := newTableRow(b.BasePath, "name", sortOrderAsc, limit, items[0])
+	row.ShowFolder, row.Folder = true, folder
+	if err := tmpl.ExecuteTemplate(w, "row", row); err != nil {
+		fmt.Printf("Error rendering template: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+func executeSearchFoot(w http.ResponseWriter, data *searchPage, tmpl *template.Template) error {
+	if err := tmpl.ExecuteTemplate(w, "search_foot", data); err != nil {
+		fmt.Printf("Error rendering template: %v\n", err)
+		return err
+	}
+	return nil
+}
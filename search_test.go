@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewKeyMatcher(t *testing.T) {
+	cases := []struct {
+		query, mode, key string
+		want             bool
+	}{
+		{"wel", "", "2024/NZ.WEL.mseed", true},
+		{"wel", searchSubstring, "2024/NZ.TAKE.mseed", false},
+		{"*.mseed", "", "2024/001/NZ.WEL.mseed", true},
+		{"*.mseed", searchGlob, "2024/001/NZ.WEL.csv", false},
+		{"2024/*/*.csv", searchGlob, "2024/001/index.csv", true},
+		{"2024/*/*.csv", searchGlob, "2024/001/002/index.csv", false},
+		{`^2024/\d{3}/NZ\.`, searchRegex, "2024/001/NZ.WEL.mseed", true},
+		{`^2024/\d{3}/NZ\.`, searchRegex, "2025/001/NZ.WEL.mseed", false},
+	}
+	for _, c := range cases {
+		match, err := newKeyMatcher(c.query, c.mode)
+		if err != nil {
+			t.Fatalf("newKeyMatcher(%q, %q): %v", c.query, c.mode, err)
+		}
+		if got := match(c.key); got != c.want {
+			t.Errorf("newKeyMatcher(%q, %q)(%q) = %v, want %v", c.query, c.mode, c.key, got, c.want)
+		}
+	}
+
+	for _, c := range []struct{ query, mode string }{{"[", searchGlob}, {"(", searchRegex}, {"x", "fuzzy"}} {
+		if _, err := newKeyMatcher(c.query, c.mode); err == nil {
+			t.Errorf("newKeyMatcher(%q, %q) accepted an invalid query", c.query, c.mode)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"data/2024/001/NZ.WEL.mseed": "a",
+		"data/2024/001/index.csv":    "b",
+		"data/2024/002/NZ.WEL.mseed": "c",
+		"data/2024/003/NZ.WEL.mseed": "d",
+		"other/NZ.WEL.mseed":         "e",
+	})
+	store.pageSize = 2
+	bucket := &Bucket{ID: "test", Name: "test-bucket", Title: "Test Bucket", Store: store}
+	srv := httptest.NewServer(newHandler(newBucketRegistry("Test", []*Bucket{bucket}), newTemplate()))
+	defer srv.Close()
+
+	get := func(query string, wantStatus int) string {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/_/search?" + query)
+		if err != nil {
+			t.Fatalf("GET search: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("search %s status = %d, want %d", query, resp.StatusCode, wantStatus)
+		}
+		return string(body)
+	}
+
+	body := get("prefix=data/&q=*.mseed&limit=2", http.StatusOK)
+	for _, want := range []string{
+		`href="/data/2024/001/NZ.WEL.mseed"`,
+		`href="/data/2024/002/NZ.WEL.mseed"`,
+		`href="/?prefix=data%2f2024%2f001%2f&page=1&limit=2">/data/2024/001/</a>`,
+		"after=data%2f2024%2f002%2fNZ.WEL.mseed",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("first page does not contain %q", want)
+		}
+	}
+	if strings.Contains(body, "index.csv") || strings.Contains(body, "003") {
+		t.Error("first page holds entries beyond the limit or non-matching keys")
+	}
+
+	body = get("prefix=data/&q=*.mseed&limit=2&after="+url.QueryEscape("data/2024/002/NZ.WEL.mseed"), http.StatusOK)
+	if !strings.Contains(body, "data/2024/003/NZ.WEL.mseed") || strings.Contains(body, "other/") || strings.Contains(body, "after=") {
+		t.Error("second page should hold only the last match without a next link")
+	}
+
+	bucket.MaxListItems = 2
+	body = get("prefix=data/&q=003&limit=10", http.StatusOK)
+	if !strings.Contains(body, "Continue searching") || !strings.Contains(body, "No matches yet") {
+		t.Error("budget-limited search does not offer to continue")
+	}
+
+	body = get("q=(&mode=regex", http.StatusBadRequest)
+	if !strings.Contains(body, "invalid regular expression") || !strings.Contains(body, `value="("`) {
+		t.Error("invalid regex is not reported with the query kept in the form")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Summaries shown in a listing are bounded per request, as each folder walks
+// its whole subtree when not cached: at most maxSummaryFolders folders, each
+// counting at most maxSummaryObjects objects. /_/api/summary, which walks a
+// single folder, counts up to the bucket's max_list_items instead.
+const (
+	maxSummaryFolders = 25
+	maxSummaryObjects = 10000
+)
+
+// folderSummary totals the objects below a prefix, in sub-folders too
+type folderSummary struct {
+	Prefix    string    `json:"prefix"`
+	Size      int64     `json:"size"`
+	Count     int       `json:"count"`
+	Newest    time.Time `json:"newest"` // zero for an empty folder
+	Truncated bool      `json:"truncated"`
+	Computed  time.Time `json:"computed"`
+}
+
+// apiSummary is the JSON form of a folder summary
+type apiSummary struct {
+	Version      int    `json:"version"`
+	Bucket       string `json:"bucket"`
+	Prefix       string `json:"prefix"`
+	Size         int64  `json:"size"`
+	Count        int    `json:"count"`
+	LastModified string `json:"last_modified,omitempty"` // RFC 3339, newest object
+	Truncated    bool   `json:"truncated"`               // stopped after max_list_items objects
+	Computed     string `json:"computed"`                // RFC 3339, when the folder was walked
+}
+
+// summarizeFolder walks every object under prefix, counting at most
+// maxItems. Summaries are kept in the bucket's summary cache, separately for
+// each budget.
+func summarizeFolder(ctx context.Context, b bucketView, prefix string, maxItems int) (folderSummary, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	sum := sha256.Sum256([]byte(prefix))
+	key := fmt.Sprintf("summary/%s/%d/%s", b.ID, maxItems, hex.EncodeToString(sum[:]))
+	if b.SummaryCache != nil {
+		if raw, ok := b.SummaryCache.Get(key); ok {
+			var s folderSummary
+			if err := json.Unmarshal(raw, &s); err == nil {
+				return s, nil
+			}
+		}
+	}
+
+	s := folderSummary{Prefix: prefix}
+	err := walkObjects(ctx, b.Store, prefix, "", func(objects []ObjectInfo) error {
+		for _, o := range objects {
+			// Zero-byte folder markers are not files
+			if strings.HasSuffix(o.Key, "/") {
+				continue
+			}
+			if s.Count == maxItems {
+				s.Truncated = true
+				return errStopWalk
+			}
+			s.Count++
+			s.Size += o.Size
+			if o.LastModified.After(s.Newest) {
+				s.Newest = o.LastModified
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return folderSummary{}, err
+	}
+	s.Computed = time.Now().UTC()
+
+	if b.SummaryCache != nil {
+		if raw, err := json.Marshal(s); err == nil {
+			b.SummaryCache.Set(key, raw, b.SummaryTTL)
+		}
+	}
+	return s, nil
+}
+
+// addFolderSummaries fills in the size and date of the first
+// maxSummaryFolders folders in items from their summaries, and reports
+// whether every folder was summarized
+func addFolderSummaries(ctx context.Context, b bucketView, items []S3Object) (all bool, err error) {
+	maxItems := min(maxSummaryObjects, b.maxListItems())
+	done := 0
+	for i := range items {
+		if !items[i].IsDirectory || items[i].Deleted {
+			continue
+		}
+		if done == maxSummaryFolders {
+			return false, nil
+		}
+		done++
+		s, err := summarizeFolder(ctx, b, items[i].Key, maxItems)
+		if err != nil {
+			return false, err
+		}
+		items[i].Summary = &s
+		items[i].Size = s.Size
+		items[i].ModTime = s.Newest
+		if !s.Newest.IsZero() {
+			items[i].LastModified = s.Newest.Format("2006-01-02 15:04:05")
+		}
+	}
+	return true, nil
+}
+
+// countFolders counts the live folders in items
+func countFolders(items []S3Object) int {
+	n := 0
+	for _, o := range items {
+		if o.IsDirectory && !o.Deleted {
+			n++
+		}
+	}
+	return n
+}
+
+// handleAPISummary serves /_/api/summary, the total size, object count and
+// newest modification time of everything under prefix
+func handleAPISummary(ctx context.Context, w http.ResponseWriter, b bucketView, prefix string) error {
+	s, err := summarizeFolder(ctx, b, prefix, b.maxListItems())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("summarizing folder: %w", err))
+		return err
+	}
+	resp := apiSummary{
+		Version:   apiVersion,
+		Bucket:    b.ID,
+		Prefix:    s.Prefix,
+		Size:      s.Size,
+		Count:     s.Count,
+		Truncated: s.Truncated,
+		Computed:  s.Computed.Format(time.RFC3339),
+	}
+	if !s.Newest.IsZero() {
+		resp.LastModified = s.Newest.UTC().Format(time.RFC3339)
+	}
+	return writeJSON(w, resp)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeFolderIsCached(t *testing.T) {
+	fake := newFakeStore(map[string]string{
+		"data/a.csv":       "aaaa",
+		"data/sub/b.csv":   "bb",
+		"data/sub/":        "",
+		"data/sub/c/d.csv": "d",
+		"other/e.csv":      "eeeee",
+	})
+	fake.pageSize = 2
+	store := &countingStore{ObjectStore: fake}
+	b := bucketView{Bucket: &Bucket{ID: "test", Store: store, SummaryCache: newMemoryCache(), SummaryTTL: time.Hour}}
+
+	s, err := summarizeFolder(context.Background(), b, "data", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Prefix != "data/" || s.Count != 3 || s.Size != 7 || s.Truncated || !s.Newest.Equal(fake.modified) {
+		t.Errorf("summary = %+v", s)
+	}
+	lists := store.lists
+	if again, err := summarizeFolder(context.Background(), b, "data/", 100); err != nil || again.Count != 3 {
+		t.Errorf("cached summary = %+v, %v", again, err)
+	}
+	if store.lists != lists {
+		t.Errorf("cached summary listed %d more pages", store.lists-lists)
+	}
+
+	if s, err := summarizeFolder(context.Background(), b, "data/", 2); err != nil || s.Count != 2 || !s.Truncated {
+		t.Errorf("capped summary = %+v, %v", s, err)
+	}
+}
+
+func TestFoldersSortBySummary(t *testing.T) {
+	store := newFakeStore(map[string]string{
+		"small/a.csv": "a",
+		"big/b.csv":   "bbbbbbbbbb",
+		"mid/c.csv":   "ccccc",
+		"top.csv":     "t",
+	})
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	l := getAPIListing(t, srv.URL+"/_/api/list?summary=1&sortby=size&sort=desc")
+	if keys := apiKeysOf(l.Items); keys != "big/,mid/,small/,top.csv" {
+		t.Errorf("folders sorted by size = %s", keys)
+	}
+	if l.Items[0].Size != 10 || l.Items[0].Count != 1 || l.Items[0].LastModified != "2024-01-02T03:04:05Z" {
+		t.Errorf("summarized folder = %+v", l.Items[0])
+	}
+
+	l = getAPIListing(t, srv.URL+"/_/api/list?sortby=size&sort=desc")
+	if keys := apiKeysOf(l.Items); keys != "small/,mid/,big/,top.csv" {
+		t.Errorf("folders without summaries = %s, want name order", keys)
+	}
+
+	resp, err := http.Get(srv.URL + "/_/api/summary?prefix=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var s apiSummary
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Count != 4 || s.Size != 17 || s.Prefix != "" || s.Bucket != "test" {
+		t.Errorf("root summary = %+v", s)
+	}
+}
+
+func TestManyFoldersAreSummarizedPerPage(t *testing.T) {
+	objects := map[string]string{}
+	for i := range maxSummaryFolders + 5 {
+		objects[fmt.Sprintf("f%02d/a.csv", i)] = strings.Repeat("x", i)
+	}
+	store := &countingStore{ObjectStore: newFakeStore(objects)}
+	srv := httptest.NewServer(newHandler(newTestRegistry(store), newTemplate()))
+	defer srv.Close()
+
+	l := getAPIListing(t, srv.URL+"/_/api/list?summary=1&sortby=size&sort=desc&limit=10")
+	if keys := apiKeysOf(l.Items); !strings.HasPrefix(keys, "f29/,f28/,") {
+		t.Errorf("folders = %s, want descending name order", keys)
+	}
+	if l.Items[9].Size != 20 || l.Items[9].Count != 1 {
+		t.Errorf("folder on the page = %+v, want it summarized", l.Items[9])
+	}
+	// One listing of the folder, then one walk per folder on the page
+	if store.lists != 11 {
+		t.Errorf("listed %d pages, want 11", store.lists)
+	}
+
+	resp, err := http.Get(srv.URL + "/?summary=1&sortby=size&sort=desc&limit=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "too many sub-folders to sort them by size") {
+		t.Errorf("listing does not say the sort is partial:\n%s", body)
+	}
+}
+
+func apiKeysOf(items []apiObject) string {
+	keys := make([]string, 0, len(items))
+	for _, o := range items {
+		keys = append(keys, o.Key)
+	}
+	return strings.Join(keys, ",")
+}
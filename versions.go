@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxHistoryVersions bounds the versions shown on a history page
+const maxHistoryVersions = 1000
+
+// errVersionsUnsupported is returned for stores that cannot list versions
+var errVersionsUnsupported = errors.New("this bucket does not support listing object versions")
+
+// versionLister is implemented by stores that can list object versions. It
+// is optional so that ObjectStore stays small; use listVersions to call it.
+type versionLister interface {
+	// ListVersions returns a single page of versions and delete markers,
+	// ordered by key and then newest first. Token and StartAfter work as
+	// for List.
+	ListVersions(ctx context.Context, opts ListOptions) (*VersionPage, error)
+}
+
+// VersionPage is one page of results returned by versionLister.ListVersions
+type VersionPage struct {
+	CommonPrefixes []string
+	Versions       []ObjectVersion
+	NextToken      string // opaque continuation token, empty when there are no more pages
+}
+
+// ObjectVersion is one version of an object, or a delete marker
+type ObjectVersion struct {
+	Key          string
+	VersionID    string
+	LastModified time.Time
+	Size         int64
+	ETag         string
+	IsLatest     bool
+	DeleteMarker bool
+}
+
+// listVersions lists a page of versions from store, or fails with
+// errVersionsUnsupported
+func listVersions(ctx context.Context, store ObjectStore, opts ListOptions) (*VersionPage, error) {
+	vl, ok := store.(versionLister)
+	if !ok {
+		return nil, errVersionsUnsupported
+	}
+	return vl.ListVersions(ctx, opts)
+}
+
+// ListVersionsResult represents the XML response from the S3
+// ListObjectVersions API
+type ListVersionsResult struct {
+	XMLName             xml.Name       `xml:"ListVersionsResult"`
+	CommonPrefixes      []CommonPrefix `xml:"CommonPrefixes"`
+	Versions            []Version      `xml:"Version"`
+	DeleteMarkers       []Version      `xml:"DeleteMarker"`
+	IsTruncated         bool           `xml:"IsTruncated"`
+	NextKeyMarker       string         `xml:"NextKeyMarker"`
+	NextVersionIDMarker string         `xml:"NextVersionIdMarker"`
+}
+
+// Version represents an object version or delete marker in the S3 bucket
+type Version struct {
+	Key          string    `xml:"Key"`
+	VersionID    string    `xml:"VersionId"`
+	IsLatest     bool      `xml:"IsLatest"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+}
+
+// ListVersions implements versionLister using the S3 ListObjectVersions API.
+// The continuation token holds the key and version markers.
+func (s *s3Store) ListVersions(ctx context.Context, opts ListOptions) (*VersionPage, error) {
+	q := neturl.Values{}
+	q.Set("versions", "")
+	q.Set("prefix", opts.Prefix)
+	if opts.Delimiter != "" {
+		q.Set("delimiter", opts.Delimiter)
+	}
+	if opts.MaxKeys > 0 {
+		q.Set("max-keys", strconv.Itoa(opts.MaxKeys))
+	}
+	switch {
+	case opts.Token != "":
+		markers, err := neturl.ParseQuery(opts.Token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version token: %v", err)
+		}
+		q.Set("key-marker", markers.Get("key"))
+		q.Set("version-id-marker", markers.Get("version"))
+	case opts.StartAfter != "":
+		q.Set("key-marker", opts.StartAfter)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.bucketURL+"/?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/xml")
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make HTTP request: %v", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			fmt.Printf("Error closing response body: %v\n", closeErr)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("HTTP request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result ListVersionsResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse XML response: %v", err)
+	}
+	page := &VersionPage{
+		CommonPrefixes: make([]string, 0, len(result.CommonPrefixes)),
+		Versions:       make([]ObjectVersion, 0, len(result.Versions)+len(result.DeleteMarkers)),
+	}
+	if result.IsTruncated {
+		page.NextToken = neturl.Values{"key": {result.NextKeyMarker}, "version": {result.NextVersionIDMarker}}.Encode()
+	}
+	for _, cp := range result.CommonPrefixes {
+		page.CommonPrefixes = append(page.CommonPrefixes, cp.Prefix)
+	}
+	for _, v := range result.Versions {
+		page.Versions = append(page.Versions, ObjectVersion{
+			Key: v.Key, VersionID: v.VersionID, LastModified: v.LastModified,
+			Size: v.Size, ETag: v.ETag, IsLatest: v.IsLatest,
+		})
+	}
+	for _, v := range result.DeleteMarkers {
+		page.Versions = append(page.Versions, ObjectVersion{
+			Key: v.Key, VersionID: v.VersionID, LastModified: v.LastModified,
+			IsLatest: v.IsLatest, DeleteMarker: true,
+		})
+	}
+	// Versions and delete markers arrive interleaved but are decoded apart
+	sort.SliceStable(page.Versions, func(i, j int) bool {
+		a, b := page.Versions[i], page.Versions[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.LastModified.After(b.LastModified)
+	})
+	return page, nil
+}
+
+// keyVersions lists the versions of a single key, newest first, stopping
+// after maxVersions
+func keyVersions(ctx context.Context, store ObjectStore, key string, maxVersions int) (versions []ObjectVersion, truncated bool, err error) {
+	token := ""
+	for {
+		page, err := listVersions(ctx, store, ListOptions{Prefix: key, Token: token})
+		if err != nil {
+			return nil, false, err
+		}
+		for _, v := range page.Versions {
+			// The prefix also matches longer keys, which sort after key
+			if v.Key > key {
+				return versions, false, nil
+			}
+			if v.Key != key {
+				continue
+			}
+			if len(versions) == maxVersions {
+				return versions, true, nil
+			}
+			versions = append(versions, v)
+		}
+		if page.NextToken == "" {
+			return versions, false, nil
+		}
+		token = page.NextToken
+	}
+}
+
+// listDeleted lists the files directly under prefix whose latest version is a
+// delete marker, scanning at most maxItems versions
+func listDeleted(ctx context.Context, store ObjectStore, prefix string, maxItems int) (deleted []S3Object, truncated bool, err error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	token, scanned := "", 0
+	for {
+		page, err := listVersions(ctx, store, ListOptions{Prefix: prefix, Delimiter: "/", Token: token})
+		if err != nil {
+			return nil, false, err
+		}
+		for _, v := range page.Versions {
+			if scanned == maxItems {
+				return deleted, true, nil
+			}
+			scanned++
+			if !v.IsLatest || !v.DeleteMarker || v.Key == prefix {
+				continue
+			}
+			deleted = append(deleted, S3Object{
+				Key:          v.Key,
+				Name:         path.Base(v.Key),
+				LastModified: v.LastModified.Format("2006-01-02 15:04:05"),
+				ModTime:      v.LastModified,
+				Deleted:      true,
+			})
+		}
+		if page.NextToken == "" {
+			return deleted, false, nil
+		}
+		token = page.NextToken
+	}
+}
+
+const historyTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>History: {{.Name}} - {{.Title}}</title>
+    {{template "style"}}
+    {{template "theme"}}
+</head>
+<body>
+    <div class="container">
+        <div class="theme-toggle">
+            <button onclick="toggleTheme()" aria-label="Toggle dark mode">🌓 Theme</button>
+        </div>
+        <h1>{{.Title}}</h1>
+        <div class="breadcrumb" aria-label="Breadcrumb">
+            {{if .HomeURL}}<a href="{{.HomeURL}}">Home</a> /{{end}}
+            {{range $i, $b := .Breadcrumbs}}
+                {{if $i}}/ {{end}}<a href="{{$.BasePath}}{{$b.Path}}">{{$b.Name}}</a>
+            {{end}}
+            / <span class="current">{{.Name}} history</span>
+        </div>
+        <table aria-label="Object versions">
+            <thead>
+                <tr>
+                    <th>Version</th>
+                    <th class="date">Last Modified</th>
+                    <th class="size">Size</th>
+                    <th>Status</th>
+                    <th>Actions</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{range .Versions}}
+                <tr>
+                    <td><code>{{.VersionID}}</code></td>
+                    <td class="date">{{.LastModified.Format "2006-01-02 15:04:05"}}</td>
+                    <td class="size">{{if .DeleteMarker}}-{{else}}{{formatSize .Size}}{{end}}</td>
+                    <td>{{if .DeleteMarker}}🗑️ Delete marker{{end}}{{if .IsLatest}} Latest{{end}}</td>
+                    <td>
+                        {{if not .DeleteMarker}}
+                        <a href="{{$.BasePath}}{{.Key}}?versionId={{.VersionID}}" download class="download-btn" aria-label="Download this version">⬇️</a>
+                        {{end}}
+                    </td>
+                </tr>
+                {{else}}
+                <tr>
+                    <td colspan="5" style="text-align:center; color:#888;">No versions of this key were found.</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+        {{if .Truncated}}<p class="notice">Only the newest {{len .Versions}} versions are shown.</p>{{end}}
+    </div>
+</body>
+</html>`
+
+// historyPage is the data of the history page template
+type historyPage struct {
+	Title, BasePath, HomeURL string
+	Breadcrumbs              []Breadcrumb
+	Key, Name                string
+	Versions                 []ObjectVersion
+	Truncated                bool
+}
+
+// apiVersions is the JSON form of the history page
+type apiVersions struct {
+	Version   int                `json:"version"`
+	Bucket    string             `json:"bucket"`
+	Key       string             `json:"key"`
+	Versions  []apiObjectVersion `json:"versions"`
+	Truncated bool               `json:"truncated"`
+}
+
+// apiObjectVersion is one version in the JSON history
+type apiObjectVersion struct {
+	VersionID    string `json:"version_id"`
+	LastModified string `json:"last_modified"` // RFC 3339
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag,omitempty"`
+	IsLatest     bool   `json:"is_latest"`
+	DeleteMarker bool   `json:"delete_marker"`
+	ProxyPath    string `json:"proxy_path,omitempty"` // this version through the browser
+}
+
+// handleHistory serves /_/history/<key>, the versions and delete markers of
+// key as an HTML page or, when format is JSON, as apiVersions
+func handleHistory(ctx context.Context, w http.ResponseWriter, b bucketView, key string, limit int, format string, tmpl *template.Template) error {
+	versions, truncated, err := keyVersions(ctx, b.Store, key, maxHistoryVersions)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, errVersionsUnsupported) {
+			status = http.StatusNotImplemented
+		}
+		if format == formatJSON {
+			writeJSONError(w, status, err)
+		} else {
+			writeErrorf(w, status, "Error listing versions: %v\n", err)
+		}
+		return err
+	}
+
+	if format == formatJSON {
+		resp := apiVersions{
+			Version:   apiVersion,
+			Bucket:    b.ID,
+			Key:       key,
+			Versions:  make([]apiObjectVersion, 0, len(versions)),
+			Truncated: truncated,
+		}
+		for _, v := range versions {
+			item := apiObjectVersion{
+				VersionID:    v.VersionID,
+				LastModified: v.LastModified.UTC().Format(time.RFC3339),
+				Size:         v.Size,
+				ETag:         v.ETag,
+				IsLatest:     v.IsLatest,
+				DeleteMarker: v.DeleteMarker,
+			}
+			if !v.DeleteMarker {
+				u := neturl.URL{Path: b.BasePath + key, RawQuery: neturl.Values{"versionId": {v.VersionID}}.Encode()}
+				item.ProxyPath = u.String()
+			}
+			resp.Versions = append(resp.Versions, item)
+		}
+		return writeJSON(w, resp)
+	}
+
+	data := historyPage{
+		Title:       b.Title,
+		BasePath:    b.BasePath,
+		HomeURL:     b.HomeURL,
+		Breadcrumbs: generateBreadcrumbs(b.Title, key[:strings.LastIndex(key, "/")+1], sortOrderAsc, limit),
+		Key:         key,
+		Name:        path.Base(key),
+		Versions:    versions,
+		Truncated:   truncated,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.ExecuteTemplate(w, "history", data); err != nil {
+		fmt.Printf("Error rendering template: %v\n", err)
+		return err
+	}
+	return nil
+}
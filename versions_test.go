@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newVersionedS3 starts an httptest server for a versioned bucket holding
+// data/a.csv in two versions and data/gone.csv behind a delete marker. The
+// versions listing is split in two pages.
+func newVersionedS3(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		write := func(body string) {
+			w.Header().Set("Content-Type", "application/xml")
+			if _, err := io.WriteString(w, body); err != nil {
+				t.Errorf("write response: %v", err)
+			}
+		}
+		switch {
+		case r.URL.Path == "/" && q.Has("versions") && q.Get("key-marker") == "":
+			write(`<?xml version="1.0" encoding="UTF-8"?>
+<ListVersionsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <IsTruncated>true</IsTruncated>
+  <NextKeyMarker>data/a.csv</NextKeyMarker>
+  <NextVersionIdMarker>v1</NextVersionIdMarker>
+  <Version><Key>data/a.csv</Key><VersionId>v2</VersionId><IsLatest>true</IsLatest><LastModified>2024-02-01T00:00:00.000Z</LastModified><ETag>"e2"</ETag><Size>20</Size></Version>
+  <Version><Key>data/a.csv</Key><VersionId>v1</VersionId><IsLatest>false</IsLatest><LastModified>2024-01-01T00:00:00.000Z</LastModified><ETag>"e1"</ETag><Size>10</Size></Version>
+</ListVersionsResult>`)
+		case r.URL.Path == "/" && q.Has("versions"):
+			if q.Get("key-marker") != "data/a.csv" || q.Get("version-id-marker") != "v1" {
+				t.Errorf("second versions page query = %v", q)
+			}
+			write(`<?xml version="1.0" encoding="UTF-8"?>
+<ListVersionsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <IsTruncated>false</IsTruncated>
+  <Version><Key>data/a.csv.bak</Key><VersionId>b1</VersionId><IsLatest>true</IsLatest><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>1</Size></Version>
+  <DeleteMarker><Key>data/gone.csv</Key><VersionId>d1</VersionId><IsLatest>true</IsLatest><LastModified>2024-03-01T00:00:00.000Z</LastModified></DeleteMarker>
+  <Version><Key>data/gone.csv</Key><VersionId>g1</VersionId><IsLatest>false</IsLatest><LastModified>2023-12-01T00:00:00.000Z</LastModified><Size>5</Size></Version>
+</ListVersionsResult>`)
+		case r.URL.Path == "/":
+			write(`<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <IsTruncated>false</IsTruncated>
+  <Contents><Key>data/a.csv</Key><LastModified>2024-02-01T00:00:00.000Z</LastModified><Size>20</Size></Contents>
+  <Contents><Key>data/a.csv.bak</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><Size>1</Size></Contents>
+</ListBucketResult>`)
+		case r.URL.Path == "/data/a.csv" && q.Get("versionId") == "v1":
+			if _, err := io.WriteString(w, "old"); err != nil {
+				t.Errorf("write object: %v", err)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestKeyVersions(t *testing.T) {
+	s3 := newVersionedS3(t)
+	store := newS3Store(s3.Client(), s3.URL)
+
+	versions, truncated, err := keyVersions(context.Background(), store, "data/a.csv", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncated || len(versions) != 2 || versions[0].VersionID != "v2" || !versions[0].IsLatest || versions[1].Size != 10 {
+		t.Errorf("versions = %+v, truncated %v", versions, truncated)
+	}
+
+	versions, _, err = keyVersions(context.Background(), store, "data/gone.csv", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || !versions[0].DeleteMarker || versions[1].VersionID != "g1" {
+		t.Errorf("deleted key versions = %+v", versions)
+	}
+
+	if _, _, err := keyVersions(context.Background(), newFakeStore(nil), "a", 10); err != errVersionsUnsupported {
+		t.Errorf("fake store error = %v, want errVersionsUnsupported", err)
+	}
+}
+
+func TestHistoryAndDeletedListing(t *testing.T) {
+	s3 := newVersionedS3(t)
+	srv := httptest.NewServer(newHandler(newTestRegistry(newS3Store(s3.Client(), s3.URL)), newTemplate()))
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("/_/history/data/a.csv")
+	if status != http.StatusOK || !strings.Contains(body, "v1") || !strings.Contains(body, `href="/data/a.csv?versionId=v1"`) {
+		t.Errorf("history page = %d:\n%s", status, body)
+	}
+
+	status, body = get("/_/api/history/data/a.csv")
+	var h apiVersions
+	if err := json.Unmarshal([]byte(body), &h); err != nil || status != http.StatusOK {
+		t.Fatalf("history JSON = %d %q: %v", status, body, err)
+	}
+	if len(h.Versions) != 2 || h.Versions[1].ProxyPath != "/data/a.csv?versionId=v1" || h.Versions[0].ETag != `"e2"` {
+		t.Errorf("history JSON versions = %+v", h.Versions)
+	}
+
+	if status, body = get("/data/a.csv?versionId=v1"); status != http.StatusOK || body != "old" {
+		t.Errorf("versioned file = %d %q", status, body)
+	}
+
+	if _, body = get("/?prefix=data/"); strings.Contains(body, "gone.csv") {
+		t.Error("listing shows a deleted key without deleted=1")
+	}
+	_, body = get("/?prefix=data/&deleted=1")
+	if !strings.Contains(body, `href="/_/history/data/gone.csv"`) || !strings.Contains(body, "&amp;deleted=1") {
+		t.Errorf("listing with deleted=1 does not link the deleted key:\n%s", body)
+	}
+}